@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -13,23 +12,23 @@ import (
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 var (
 	buildCmd *cobra.Command
 )
 
-func parseBuildFlags() {
+func parseBuildFlags() error {
 	if len(flagImageName) < 1 {
-		PrintFlagsError(buildCmd, "--image", fmt.Errorf("empty image name"))
+		return PrintFlagsError(buildCmd, "--image", fmt.Errorf("empty image name"))
 	}
 
 	{
 		var err error
 		var logLevel logging.Lvl
 		if logLevel, err = logging.LvlFromString(flagLogLevel); err != nil {
-			fmt.Printf("invalid `log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `log-level`: %v", err)
 		}
 
 		var formatter logging.Format
@@ -47,10 +46,11 @@ func parseBuildFlags() {
 	{
 		var err error
 		if _, err = logging.LvlFromString(flagSebakLogLevel); err != nil {
-			fmt.Printf("invalid `sebak-log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `sebak-log-level`: %v", err)
 		}
 	}
+
+	return nil
 }
 
 func buildImage(cli *client.Client, path string, fromSource bool) error {
@@ -69,7 +69,7 @@ func buildImage(cli *client.Client, path string, fromSource bool) error {
 		Dockerfile:     dockerfile,
 	}
 
-	resp, err := cli.ImageBuild(context.Background(), ctx, buildOptions)
+	resp, err := cli.ImageBuild(rootContext, ctx, buildOptions)
 	if err != nil {
 		return err
 	}
@@ -83,13 +83,18 @@ func init() {
 		Use:   "build <config>",
 		Short: "build sebak image",
 		Args:  cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, args []string) {
+		RunE: func(c *cobra.Command, args []string) error {
 			var err error
 			if config, err = parseConfig(args[0]); err != nil {
-				PrintFlagsError(runCmd, "<config>", err)
+				return PrintFlagsError(buildCmd, "<config>", err)
 			}
 
-			parseBuildFlags()
+			if err = parseBuildFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
 
 			logImage := log.New(logging.Ctx{"image": flagImageName})
 
@@ -103,7 +108,7 @@ func init() {
 					go func(d *DockerHost) {
 						defer wg.Done()
 
-						if err := removeImage(d.Client(), flagImageName); err != nil {
+						if err := composer.RemoveImage(rootContext, d, flagImageName, composerOptions()); err != nil {
 							logImage.Error("failed to remove image", "error", err)
 							return
 						}
@@ -117,12 +122,15 @@ func init() {
 			wg.Add(len(config.DockerHosts))
 
 			var foundErrors []error
+			var lock sync.Mutex
 			ch := Ticker()
 			for _, dh := range config.DockerHosts {
 				go func(d *DockerHost) {
 					defer wg.Done()
 					if err := buildImage(d.Client(), config.DockerPath, flagBuildFromSource); err != nil {
+						lock.Lock()
 						foundErrors = append(foundErrors, err)
+						lock.Unlock()
 						logImage.Error("failed to build image", "error", err)
 						return
 					}
@@ -133,9 +141,11 @@ func init() {
 			ch <- true
 			if len(foundErrors) > 0 {
 				logImage.Error("failed to create docker image")
-			} else {
-				logImage.Debug("successfully created docker image")
+				return reported(exitCodeError, foundErrors[0])
 			}
+			logImage.Debug("successfully created docker image")
+
+			return nil
 		},
 	}
 
@@ -0,0 +1,373 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+const (
+	chaosKill    string = "kill"
+	chaosPause   string = "pause"
+	chaosStop    string = "stop"
+	chaosRestart string = "restart"
+	chaosUnpause string = "unpause"
+	chaosStart   string = "start"
+)
+
+var (
+	chaosCmd *cobra.Command
+
+	chaosFaultActions = []string{chaosKill, chaosPause, chaosStop, chaosRestart}
+)
+
+// chaosNode is the node container under chaos; `fault` is the last fault
+// action, which is not recovered yet. The restarted node keeps the `restart`
+// fault until it responds again.
+type chaosNode struct {
+	Host      *DockerHost
+	ID        string
+	Container string
+	fault     string
+}
+
+type ChaosAction struct {
+	Time      time.Time
+	Action    string
+	Container string
+	Error     error
+}
+
+func (a ChaosAction) String() string {
+	s := fmt.Sprintf("%s %-7s %s", a.Time.Format(time.RFC3339Nano), a.Action, a.Container)
+	if a.Error != nil {
+		s += fmt.Sprintf(" error=%v", a.Error)
+	}
+
+	return s
+}
+
+func runChaosAction(n *chaosNode, action string) error {
+	cli := n.Host.Client()
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if canceled() && (action == chaosStart || action == chaosUnpause) {
+		// the faulty nodes are recovered even after canceled
+		ctx, cancel = cleanupContext()
+	} else {
+		ctx, cancel = dockerContext()
+	}
+	defer cancel()
+
+	switch action {
+	case chaosKill:
+		return cli.ContainerKill(ctx, n.ID, "SIGKILL")
+	case chaosPause:
+		return cli.ContainerPause(ctx, n.ID)
+	case chaosStop:
+		return cli.ContainerStop(ctx, n.ID, nil)
+	case chaosRestart:
+		return cli.ContainerRestart(ctx, n.ID, nil)
+	case chaosUnpause:
+		return cli.ContainerUnpause(ctx, n.ID)
+	case chaosStart:
+		return cli.ContainerStart(ctx, n.ID, types.ContainerStartOptions{})
+	default:
+		return fmt.Errorf("unknown action, '%s'", action)
+	}
+}
+
+// isBack checks whether the restarted node is running and responds to the
+// node info request.
+func (n *chaosNode) isBack() bool {
+	j, err := inspectContainer(n.Host, n.ID)
+	if err != nil || j.State == nil || !j.State.Running {
+		return false
+	}
+
+	endpoint, err := getPublishEndpoint(n.Host, j)
+	if err != nil {
+		return false
+	}
+
+	_, err = getNodeInfo(endpoint)
+
+	return err == nil
+}
+
+// recoverAction returns the action to recover the fault.
+func recoverAction(fault string) string {
+	if fault == chaosPause {
+		return chaosUnpause
+	}
+
+	return chaosStart
+}
+
+// Chaos runs the fault actions by the random schedule, but the number of
+// faulty nodes never exceeds `maxFaulty`.
+type Chaos struct {
+	nodes     []*chaosNode
+	actions   []string
+	maxFaulty int
+	interval  time.Duration
+	rand      *rand.Rand
+	History   []ChaosAction
+}
+
+// faulty returns the faulty nodes, which can be recovered by action, the
+// restarting nodes and the healthy nodes; the restarting nodes, which are
+// back, become healthy.
+func (c *Chaos) faulty() (nodes, restarting, healthy []*chaosNode) {
+	for _, n := range c.nodes {
+		if n.fault == chaosRestart && n.isBack() {
+			log.Debug("restarted node is back", "container", n.Container)
+			n.fault = ""
+		}
+
+		switch n.fault {
+		case "":
+			healthy = append(healthy, n)
+		case chaosRestart:
+			restarting = append(restarting, n)
+		default:
+			nodes = append(nodes, n)
+		}
+	}
+
+	return
+}
+
+func (c *Chaos) do(n *chaosNode, action string) {
+	a := ChaosAction{Time: time.Now(), Action: action, Container: n.Container}
+	a.Error = runChaosAction(n, action)
+	c.History = append(c.History, a)
+
+	fmt.Println(a)
+	if a.Error != nil {
+		log.Error("failed to run chaos action", "action", action, "container", n.Container, "error", a.Error)
+		return
+	}
+
+	switch action {
+	case chaosKill, chaosPause, chaosStop, chaosRestart:
+		n.fault = action
+	case chaosUnpause, chaosStart:
+		n.fault = ""
+	}
+}
+
+// step runs one action; if some nodes are faulty, it recovers one of them by
+// half chance, or when no more fault is allowed. The restarting nodes are
+// counted as faulty until they are back. The random numbers are drawn in the
+// same order whatever the node states, so the nodes which are back late do not
+// shift the draws of the next steps.
+func (c *Chaos) step() {
+	recoverFirst := c.rand.Intn(2) == 0
+	index := c.rand.Int()
+	action := c.actions[c.rand.Intn(len(c.actions))]
+
+	faulty, restarting, healthy := c.faulty()
+
+	canInject := len(faulty)+len(restarting) < c.maxFaulty && len(healthy) > 0
+	if len(faulty) > 0 && (!canInject || recoverFirst) {
+		n := faulty[index%len(faulty)]
+		c.do(n, recoverAction(n.fault))
+		return
+	}
+
+	if !canInject {
+		return
+	}
+
+	c.do(healthy[index%len(healthy)], action)
+}
+
+func (c *Chaos) Run(duration time.Duration) {
+	end := time.Now().Add(duration)
+	for time.Now().Before(end) {
+		c.step()
+
+		// wait between 0.5 and 1.5 times of interval
+		wait := c.interval/2 + time.Duration(c.rand.Int63n(int64(c.interval)+1))
+		if remain := time.Until(end); wait > remain {
+			wait = remain
+		}
+		if !sleep(wait) {
+			return
+		}
+	}
+}
+
+// Recover recovers all the faulty nodes; the restarting nodes are left to
+// come back by themselves.
+func (c *Chaos) Recover() {
+	faulty, _, _ := c.faulty()
+	for _, n := range faulty {
+		c.do(n, recoverAction(n.fault))
+	}
+}
+
+// waitRecovery waits until all the nodes are reachable, agree on the blocks
+// and the highest block height exceeds the given height.
+func waitRecovery(height uint64, timeout time.Duration) (result ConsensusCheckResult, recovered bool) {
+	end := time.Now().Add(timeout)
+	for {
+		targets, err := findNodeTargets(config.DockerHosts)
+		if err != nil {
+			log.Error("failed to get containers", "error", err)
+		} else {
+			result = checkConsensus(targets, 0, 0, flagLagThreshold)
+			if result.ExitCode() == 0 && result.To > height {
+				recovered = true
+				return
+			}
+		}
+
+		if time.Now().After(end) {
+			return
+		}
+		if !sleep(time.Second * 5) {
+			return
+		}
+	}
+}
+
+func init() {
+	chaosCmd = &cobra.Command{
+		Use:   "chaos <config>",
+		Short: "kill, pause, stop and restart sebak nodes randomly",
+		Long: `kill, pause, stop and restart sebak nodes randomly
+
+The actions are scheduled by the random seed, but the restarted node can be
+chosen again only after it responds, so the same seed makes the same schedule
+only if the restarted nodes come back in the same steps. After '--duration', all the nodes are recovered and the consensus of
+nodes is checked; if the network is not recovered in '--recovery-timeout', the
+exit code is not 0.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(chaosCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			for _, a := range flagChaosActions {
+				var found bool
+				for _, f := range chaosFaultActions {
+					if a == f {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return PrintFlagsError(chaosCmd, "--action", fmt.Errorf("unknown action, '%s'", a))
+				}
+			}
+			actions := []string(flagChaosActions)
+			if len(actions) < 1 {
+				actions = chaosFaultActions
+			}
+
+			if flagChaosInterval <= 0 {
+				return PrintFlagsError(chaosCmd, "--interval", fmt.Errorf("must be greater than 0"))
+			}
+
+			var nodes []*chaosNode
+			for _, dh := range config.DockerHosts {
+				cl, err := composer.Containers(rootContext, dh, composerOptions())
+				if err != nil {
+					log.Error("failed to get containers", "error", err)
+					return reported(exitCodeError, err)
+				}
+				for _, c := range cl {
+					if c.State != "running" {
+						continue
+					}
+					nodes = append(nodes, &chaosNode{Host: dh, ID: c.ID, Container: GetContainerName(c.Names)})
+				}
+			}
+			if len(nodes) < 1 {
+				return PrintError(chaosCmd, fmt.Errorf("running containers not found"))
+			}
+
+			maxFaulty := flagChaosMaxFaulty
+			if maxFaulty < 0 {
+				maxFaulty = (len(nodes) - 1) / 3
+			}
+			if maxFaulty < 1 {
+				return PrintFlagsError(chaosCmd, "--max-faulty", fmt.Errorf("at least 1 faulty node must be allowed"))
+			}
+
+			seed := flagChaosSeed
+			if seed == 0 {
+				seed = time.Now().UnixNano()
+			}
+
+			var height uint64
+			if targets, err := findNodeTargets(config.DockerHosts); err == nil {
+				for _, s := range getNodeStatuses(targets) {
+					if s.Error == nil && s.Info.Block.Height > height {
+						height = s.Info.Block.Height
+					}
+				}
+			}
+
+			fmt.Printf(
+				"chaos: seed=%d duration=%s max-faulty=%d actions=%s nodes=%d height=%d\n",
+				seed, flagChaosDuration, maxFaulty, strings.Join(actions, ","), len(nodes), height,
+			)
+
+			chaos := &Chaos{
+				nodes:     nodes,
+				actions:   actions,
+				maxFaulty: maxFaulty,
+				interval:  flagChaosInterval,
+				rand:      rand.New(rand.NewSource(seed)),
+			}
+			chaos.Run(flagChaosDuration)
+			chaos.Recover()
+			if canceled() {
+				fmt.Printf("chaos: canceled; %d actions; faulty nodes recovered\n", len(chaos.History))
+				return reported(exitCodeError, rootContext.Err())
+			}
+
+			fmt.Printf("chaos: done; %d actions; waiting recovery\n", len(chaos.History))
+
+			result, recovered := waitRecovery(height, flagChaosRecoveryTimeout)
+			result.Print()
+
+			if !recovered {
+				fmt.Println("chaos: network is not recovered")
+				return reported(exitCodeError, fmt.Errorf("network is not recovered"))
+			}
+			fmt.Println("chaos: network is recovered")
+
+			return nil
+		},
+	}
+
+	chaosCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	chaosCmd.Flags().DurationVar(&flagChaosDuration, "duration", flagChaosDuration, "duration of chaos")
+	chaosCmd.Flags().DurationVar(&flagChaosInterval, "interval", flagChaosInterval, "average interval between actions")
+	chaosCmd.Flags().Int64Var(&flagChaosSeed, "seed", flagChaosSeed, "random seed; by default, current time")
+	chaosCmd.Flags().IntVar(&flagChaosMaxFaulty, "max-faulty", flagChaosMaxFaulty, "maximum number of faulty nodes; by default, (n-1)/3")
+	chaosCmd.Flags().Var(&flagChaosActions, "action", "fault action, {kill, pause, stop, restart}; can be given multiple times")
+	chaosCmd.Flags().DurationVar(&flagChaosRecoveryTimeout, "recovery-timeout", flagChaosRecoveryTimeout, "timeout to wait the recovery of network")
+	chaosCmd.Flags().Uint64Var(&flagLagThreshold, "lag-threshold", flagLagThreshold, "number of blocks that node can be behind the highest")
+
+	rootCmd.AddCommand(chaosCmd)
+}
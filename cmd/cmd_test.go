@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"boscoin.io/sebak/lib/node"
+	"github.com/spikeekips/sebak-network-composer/composer"
+	"github.com/spikeekips/sebak-network-composer/composer/composertest"
+)
+
+// runCommand executes the command with the arguments and returns the
+// standard output.
+func runCommand(t *testing.T, args ...string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	var buf bytes.Buffer
+	done := make(chan bool)
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+
+	SetArgs(args)
+	err = execute()
+
+	os.Stdout = stdout
+	w.Close()
+	<-done
+	r.Close()
+
+	return buf.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	flagLogLevel = "crit"
+
+	s, err := composertest.NewServer("")
+	if err != nil {
+		t.Fatalf("failed to start fake docker host: %v", err)
+	}
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "sebak-network-composer")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := composertest.WriteConfig(dir, map[string]*composertest.Server{"host0": s}, 3)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	conf, err := composer.LoadConfig(p, composer.LoadOptions{})
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	// the nodes are not composed by `LoadConfig`, so the container names are
+	// made from the keys like `composer.ContainerName`.
+	keys := conf.DockerHosts[0].Keys
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 node keys, but %d", len(keys))
+	}
+
+	var names []string
+	addresses := map[string]bool{}
+	for _, kp := range keys {
+		names = append(names, composer.ContainerNamePrefix+node.MakeAlias(kp.Address())[:4])
+		addresses[kp.Address()] = true
+	}
+	sort.Strings(names)
+
+	// run
+	if _, err = runCommand(t, "run", p); err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+	if created := nodeContainerNames(s); !reflect.DeepEqual(created, names) {
+		t.Fatalf("expected containers, %v, but %v", names, created)
+	}
+	for _, name := range names {
+		if state, _ := s.ContainerState(name); state != "running" {
+			t.Errorf("container, '%s' is not running: %s", name, state)
+		}
+	}
+
+	// node
+	out, err := runCommand(t, "node", p, "--output", "json")
+	if err != nil {
+		t.Fatalf("failed to get node info: %v", err)
+	}
+	var infos []composer.NodeInfo
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var info composer.NodeInfo
+		if err = json.Unmarshal([]byte(line), &info); err != nil {
+			t.Fatalf("invalid node info, %q: %v", line, err)
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) != len(keys) {
+		t.Fatalf("expected %d node infos, but %d: %q", len(keys), len(infos), out)
+	}
+	for _, info := range infos {
+		if !addresses[info.Node.Address] {
+			t.Errorf("unknown node address, '%s'", info.Node.Address)
+		}
+		if info.Node.State != "CONSENSUS" {
+			t.Errorf("node, '%s' is not in consensus: %s", info.Node.Alias, info.Node.State)
+		}
+		if info.Block.Height != 1 {
+			t.Errorf("expected block height 1 of '%s', but %d", info.Node.Alias, info.Block.Height)
+		}
+	}
+
+	// logs
+	logsDir := filepath.Join(dir, "logs")
+	if _, err = runCommand(t, "logs", p, "--output-directory", logsDir); err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	for _, name := range names {
+		b, err := ioutil.ReadFile(filepath.Join(logsDir, name+".log"))
+		if err != nil {
+			t.Errorf("failed to read log of '%s': %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(b), "node started") {
+			t.Errorf("unexpected log of '%s': %q", name, string(b))
+		}
+	}
+
+	// copy from the containers
+	for _, name := range names {
+		if err = s.WriteFile(name, "/sebak/db/block.txt", []byte(name)); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	copyDir := filepath.Join(dir, "copy")
+	if _, err = runCommand(t, "copy", p, "/sebak/db", copyDir); err != nil {
+		t.Fatalf("failed to copy from containers: %v", err)
+	}
+	for _, name := range names {
+		b, err := ioutil.ReadFile(filepath.Join(copyDir, name, "db", "block.txt"))
+		if err != nil {
+			t.Errorf("failed to read copied file of '%s': %v", name, err)
+			continue
+		}
+		if string(b) != name {
+			t.Errorf("unexpected copied file of '%s': %q", name, string(b))
+		}
+	}
+
+	// copy to the containers
+	sourceDir := filepath.Join(dir, "source")
+	if err = os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("failed to create source directory: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(sourceDir, "genesis.txt"), []byte("genesis"), 0644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	if _, err = runCommand(t, "copy", "--to", p, sourceDir, "/sebak"); err != nil {
+		t.Fatalf("failed to copy to containers: %v", err)
+	}
+	flagCopyTo = false
+
+	for _, name := range names {
+		b, found := s.ReadFile(name, "/sebak/source/genesis.txt")
+		if !found {
+			t.Errorf("file is not copied into '%s'", name)
+			continue
+		}
+		if string(b) != "genesis" {
+			t.Errorf("unexpected file copied into '%s': %q", name, string(b))
+		}
+	}
+
+	// stop
+	if _, err = runCommand(t, "stop", p); err != nil {
+		t.Fatalf("failed to stop: %v", err)
+	}
+	for _, name := range names {
+		if state, _ := s.ContainerState(name); state != "exited" {
+			t.Errorf("container, '%s' is not stopped: %s", name, state)
+		}
+	}
+
+	// remove
+	if _, err = runCommand(t, "remove", p); err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+	if remained := nodeContainerNames(s); len(remained) > 0 {
+		t.Errorf("containers are not removed: %v", remained)
+	}
+}
+
+// nodeContainerNames returns the sorted names of node containers of the fake
+// docker host.
+func nodeContainerNames(s *composertest.Server) (names []string) {
+	for _, name := range s.ContainerNames() {
+		if strings.HasPrefix(name, composer.ContainerNamePrefix) {
+			names = append(names, name)
+		}
+	}
+
+	return
+}
+
+func TestCommandError(t *testing.T) {
+	flagLogLevel = "crit"
+
+	_, err := runCommand(t, "node", filepath.Join(os.TempDir(), "sebak-network-composer-not-found.toml"))
+	if err == nil {
+		t.Fatal("unknown config must fail")
+	}
+	if _, ok := err.(*reportedError); !ok {
+		t.Errorf("expected reported error, but %T: %v", err, err)
+	}
+	if code := exitCodeOf(err); code != exitCodeError {
+		t.Errorf("expected exit code %d, but %d", exitCodeError, code)
+	}
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+type (
+	Config                 = composer.Config
+	DockerHost             = composer.DockerHost
+	Volume                 = composer.Volume
+	GenesisSeed            = composer.GenesisSeed
+	UnreachableHost        = composer.UnreachableHost
+	Resources              = composer.Resources
+	Retry                  = composer.Retry
+	NetworkConfig          = composer.NetworkConfig
+	NodeNetwork            = composer.NodeNetwork
+	NodeInfo               = composer.NodeInfo
+	NodeTarget             = composer.NodeTarget
+	NodeStatus             = composer.NodeStatus
+	HostUnreachableError   = composer.HostUnreachableError
+	ImageMissingError      = composer.ImageMissingError
+	ContainerConflictError = composer.ContainerConflictError
+	NodeUnhealthyError     = composer.NodeUnhealthyError
+	MultiError             = composer.MultiError
+)
+
+// composerOptions returns the options of composer operations from the global
+// flags.
+func composerOptions() composer.Options {
+	return composer.Options{Log: log, DockerTimeout: flagDockerTimeout}
+}
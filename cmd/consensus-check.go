@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	consensusCheckCmd *cobra.Command
+)
+
+// ConsensusCheckResult is the result of comparing the blocks of nodes.
+type ConsensusCheckResult struct {
+	From           uint64
+	To             uint64
+	Heights        map[string]uint64
+	Unreachable    []string
+	Lagging        []string
+	Errors         map[string]error
+	DivergedHeight uint64
+	Forks          map[string][]string
+	Targets        map[string]NodeTarget
+}
+
+func (r ConsensusCheckResult) Diverged() bool {
+	return r.DivergedHeight > 0
+}
+
+// Empty is true if no height is checked; `From` is higher than the highest
+// block height of nodes.
+func (r ConsensusCheckResult) Empty() bool {
+	return r.From > r.To
+}
+
+func (r ConsensusCheckResult) ExitCode() int {
+	switch {
+	case r.Diverged():
+		return exitCodeDiverged
+	case r.Empty() || len(r.Unreachable) > 0 || len(r.Errors) > 0:
+		return exitCodeError
+	case len(r.Lagging) > 0:
+		return exitCodeLagging
+	default:
+		return 0
+	}
+}
+
+func (r ConsensusCheckResult) Print() {
+	if r.Empty() {
+		fmt.Printf("checked heights: none; from %d is higher than the highest height %d\n", r.From, r.To)
+	} else {
+		fmt.Printf("checked heights: %d - %d\n", r.From, r.To)
+	}
+
+	var names []string
+	for name := range r.Heights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("nodes:")
+	for _, name := range names {
+		fmt.Printf("  %s height=%d\n", name, r.Heights[name])
+	}
+
+	if len(r.Unreachable) > 0 {
+		fmt.Printf("unreachable: %s\n", strings.Join(r.Unreachable, ", "))
+	}
+	if len(r.Lagging) > 0 {
+		var lagging []string
+		for _, name := range r.Lagging {
+			lagging = append(lagging, fmt.Sprintf("%s(height=%d)", name, r.Heights[name]))
+		}
+		fmt.Printf("lagging: %s\n", strings.Join(lagging, ", "))
+	}
+	for name, err := range r.Errors {
+		fmt.Printf("error: %s: %v\n", name, err)
+	}
+
+	if r.Empty() {
+		return
+	}
+	if !r.Diverged() {
+		fmt.Println("no divergence found")
+		return
+	}
+
+	fmt.Printf("diverged at height %d:\n", r.DivergedHeight)
+
+	var keys []string
+	for k := range r.Forks {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  %s: %s\n", k, strings.Join(r.Forks[k], ", "))
+	}
+}
+
+// Report returns the test report; every node is a test case, which fails if
+// it is unreachable or lagging, and the agreement on blocks is a test case.
+func (r ConsensusCheckResult) Report(started time.Time) (report TestReport) {
+	report = TestReport{Name: "consensus-check", Started: started, Elapsed: time.Since(started)}
+
+	unreachable := map[string]bool{}
+	for _, name := range r.Unreachable {
+		unreachable[name] = true
+	}
+	lagging := map[string]bool{}
+	for _, name := range r.Lagging {
+		lagging[name] = true
+	}
+
+	var names []string
+	for name := range r.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := TestCase{Name: name, ClassName: "consensus-check.node", Status: testCasePass}
+		switch {
+		case unreachable[name]:
+			c.Message = "unreachable"
+		case r.Errors[name] != nil:
+			c.Message = r.Errors[name].Error()
+		case lagging[name]:
+			c.Message = fmt.Sprintf("lagging; height=%d, checked to %d", r.Heights[name], r.To)
+		}
+		if len(c.Message) > 0 {
+			c.Status = testCaseFail
+			c.Output = nodeLogTail(r.Targets[name])
+		}
+		report.Cases = append(report.Cases, c)
+	}
+
+	c := TestCase{
+		Name:      fmt.Sprintf("blocks %d-%d", r.From, r.To),
+		ClassName: "consensus-check.blocks",
+		Status:    testCasePass,
+		Elapsed:   report.Elapsed,
+	}
+	if r.Empty() {
+		c.Status = testCaseFail
+		c.Message = fmt.Sprintf("no block checked; from %d is higher than the highest height %d", r.From, r.To)
+	} else if r.Diverged() {
+		var forks []string
+		for k, nodes := range r.Forks {
+			forks = append(forks, fmt.Sprintf("%s: %s", k, strings.Join(nodes, ", ")))
+		}
+		sort.Strings(forks)
+
+		c.Status = testCaseFail
+		c.Message = fmt.Sprintf("diverged at height %d", r.DivergedHeight)
+		c.Output = strings.Join(forks, "\n")
+	}
+	report.Cases = append(report.Cases, c)
+
+	return
+}
+
+// checkConsensus queries the blocks of nodes from `from` to `to` and finds
+// the first height where the block hash, the number of transactions or the
+// proposer are different. If `to` is 0, it is the highest block height of
+// nodes, and if `from` is 0, the last 100 blocks are checked; if `from` is
+// higher than the highest block height, nothing is checked and the result is
+// empty. The node whose height is lower than the highest by more than
+// `lagThreshold` is lagging.
+func checkConsensus(targets []NodeTarget, from, to, lagThreshold uint64) (result ConsensusCheckResult) {
+	result.Heights = map[string]uint64{}
+	result.Errors = map[string]error{}
+	result.Targets = map[string]NodeTarget{}
+
+	var alive []NodeStatus
+	var maxHeight uint64
+	for _, s := range getNodeStatuses(targets) {
+		result.Targets[s.Name()] = s.Target
+		if s.Error != nil {
+			result.Unreachable = append(result.Unreachable, s.Name())
+			continue
+		}
+
+		alive = append(alive, s)
+		result.Heights[s.Name()] = s.Info.Block.Height
+		if s.Info.Block.Height > maxHeight {
+			maxHeight = s.Info.Block.Height
+		}
+	}
+
+	for _, s := range alive {
+		if s.Info.Block.Height+lagThreshold < maxHeight {
+			result.Lagging = append(result.Lagging, s.Name())
+		}
+	}
+
+	if to < 1 || to > maxHeight {
+		to = maxHeight
+	}
+	if from < 1 {
+		from = 1
+		if to > 100 {
+			from = to - 99
+		}
+	}
+	result.From, result.To = from, to
+
+	blocks := make([]map[uint64]BlockInfo, len(alive))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(alive))
+	for i, s := range alive {
+		go func(i int, s NodeStatus) {
+			defer wg.Done()
+
+			blocks[i] = map[uint64]BlockInfo{}
+			for h := from; h <= to && h <= s.Info.Block.Height; h++ {
+				b, err := getBlock(s.Target.Endpoint, strconv.FormatUint(h, 10))
+				if err != nil {
+					lock.Lock()
+					result.Errors[s.Name()] = fmt.Errorf("failed to get block, %d: %v", h, err)
+					lock.Unlock()
+					return
+				}
+				blocks[i][h] = b
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	for h := from; h <= to; h++ {
+		forks := map[string][]string{}
+		for i, s := range alive {
+			b, found := blocks[i][h]
+			if !found {
+				continue
+			}
+
+			k := fmt.Sprintf("hash=%s txs=%d proposer=%s", b.Hash, len(b.Transactions), b.Proposer)
+			forks[k] = append(forks[k], s.Name())
+		}
+
+		if len(forks) > 1 {
+			result.DivergedHeight = h
+			result.Forks = forks
+			break
+		}
+	}
+
+	return
+}
+
+func init() {
+	consensusCheckCmd = &cobra.Command{
+		Use:   "consensus-check <config>",
+		Short: "check whether sebak nodes agree on the blocks",
+		Long: `check whether sebak nodes agree on the blocks
+
+The exit code is 2 if the nodes are diverged, 1 if some nodes are unreachable
+or no block is checked, and 3 if some nodes are lagging.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(consensusCheckCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			if len(flagReport) > 0 {
+				if err = checkReportPath(flagReport); err != nil {
+					return PrintFlagsError(consensusCheckCmd, "--report", err)
+				}
+			}
+
+			if flagCheckTo > 0 && flagCheckFrom > flagCheckTo {
+				return PrintFlagsError(consensusCheckCmd, "--from", fmt.Errorf("higher than --to"))
+			}
+
+			var targets []NodeTarget
+			if targets, err = findNodeTargets(config.DockerHosts); err != nil {
+				log.Error("failed to get containers", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			if len(targets) < 1 {
+				return PrintError(consensusCheckCmd, fmt.Errorf("containers not found"))
+			}
+
+			started := time.Now()
+			result := checkConsensus(targets, flagCheckFrom, flagCheckTo, flagLagThreshold)
+			result.Print()
+			if err = writeReport(result.Report(started)); err != nil {
+				log.Error("failed to write report", "report", flagReport, "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			if code := result.ExitCode(); code != 0 {
+				return reported(code, fmt.Errorf("consensus check failed"))
+			}
+
+			return nil
+		},
+	}
+
+	consensusCheckCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	consensusCheckCmd.Flags().Uint64Var(&flagCheckFrom, "from", flagCheckFrom, "block height to start checking; by default, the last 100 blocks")
+	consensusCheckCmd.Flags().Uint64Var(&flagCheckTo, "to", flagCheckTo, "block height to stop checking; by default, the highest block height")
+	consensusCheckCmd.Flags().Uint64Var(&flagLagThreshold, "lag-threshold", flagLagThreshold, "number of blocks that node can be behind the highest")
+	consensusCheckCmd.Flags().StringVar(&flagReport, "report", flagReport, "save the test report; JUnit XML for .xml and JSON for .json")
+
+	rootCmd.AddCommand(consensusCheckCmd)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// cleanupTimeout is the timeout of the cleanup after the root context is
+// canceled, like removing the helper containers.
+const cleanupTimeout time.Duration = 30 * time.Second
+
+var (
+	// rootContext is canceled by SIGINT, SIGTERM or `--timeout`; every
+	// docker and http call is derived from it.
+	rootContext context.Context    = context.Background()
+	rootCancel  context.CancelFunc = func() {}
+
+	stopRootSignals = func() {}
+)
+
+// setupRootContext creates the root context and cancels it at the first
+// SIGINT or SIGTERM; at the second signal, the process exits immediately.
+// The signals of the previous root context are not handled anymore.
+func setupRootContext() {
+	stopRootSignals()
+	rootCancel()
+
+	if flagTimeout > 0 {
+		rootContext, rootCancel = context.WithTimeout(context.Background(), flagTimeout)
+	} else {
+		rootContext, rootCancel = context.WithCancel(context.Background())
+	}
+
+	cancel := rootCancel
+	stop := make(chan struct{})
+	stopRootSignals = func() { close(stop) }
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case s := <-signals:
+			fmt.Fprintf(os.Stderr, "\n%s received; canceling, send again to exit immediately\n", s)
+			cancel()
+		case <-stop:
+			return
+		}
+
+		select {
+		case <-signals:
+			os.Exit(130)
+		case <-stop:
+		}
+	}()
+}
+
+// dockerContext returns the context of one short docker call, which is
+// limited by `--docker-timeout`.
+func dockerContext() (context.Context, context.CancelFunc) {
+	return dockerContextFrom(rootContext)
+}
+
+// dockerContextFrom is like `dockerContext`, but it is derived from the
+// given context, like the attempt context of `Retry.Do`.
+func dockerContextFrom(ctx context.Context) (context.Context, context.CancelFunc) {
+	if flagDockerTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, flagDockerTimeout)
+}
+
+// cleanupContext returns the context for the cleanup, which must be done
+// even after the root context is canceled.
+func cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cleanupTimeout)
+}
+
+// canceled returns true if the root context is canceled or timed out.
+func canceled() bool {
+	return rootContext.Err() != nil
+}
+
+// sleep waits for the duration; it returns false if the root context is done
+// before.
+func sleep(d time.Duration) bool {
+	return sleepContext(rootContext, d)
+}
+
+// sleepContext waits for the duration; it returns false if the context is
+// done before.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,19 +13,20 @@ import (
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 var (
-	copyCmd *cobra.Command
+	copyCmd  *cobra.Command
+	copyMode CopyMode = CopyModeDefault
 )
 
-func parseCopyFlags() {
+func parseCopyFlags() error {
 	{
 		var err error
 		var logLevel logging.Lvl
 		if logLevel, err = logging.LvlFromString(flagLogLevel); err != nil {
-			fmt.Printf("invalid `log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `log-level`: %v", err)
 		}
 
 		var formatter logging.Format
@@ -39,57 +41,111 @@ func parseCopyFlags() {
 		log.SetHandler(logging.LvlFilterHandler(logLevel, logHandler))
 	}
 
+	{
+		var modes []string
+		copyMode = CopyModeDefault
+		if flagCopyOverwrite {
+			modes = append(modes, "--overwrite")
+			copyMode = CopyModeOverwrite
+		}
+		if flagCopySkipExisting {
+			modes = append(modes, "--skip-existing")
+			copyMode = CopyModeSkipExisting
+		}
+		if flagCopyMerge {
+			modes = append(modes, "--merge")
+			copyMode = CopyModeMerge
+		}
+
+		if len(modes) > 1 {
+			return PrintFlagsError(copyCmd, strings.Join(modes, ", "), fmt.Errorf("can not be used together"))
+		}
+		if len(modes) > 0 && flagCopyTo {
+			return PrintFlagsError(copyCmd, modes[0], fmt.Errorf("can not be used with --to"))
+		}
+	}
+
 	{
 		var err error
 		if _, err = logging.LvlFromString(flagSebakLogLevel); err != nil {
-			fmt.Printf("invalid `sebak-log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `sebak-log-level`: %v", err)
 		}
 	}
+
+	return nil
 }
 
 func init() {
 	copyCmd = &cobra.Command{
 		Use:   "copy <config> <source> <output>",
-		Short: "copy from sebak containers",
-		Args:  cobra.ExactArgs(3),
-		Run: func(c *cobra.Command, args []string) {
+		Short: "copy from or to sebak containers",
+		Long: `copy from or to sebak containers
+
+By default, <source> in the containers is copied into the local <output>
+directory. With '--to', the local <source> is copied into <output> path of the
+containers.`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(c *cobra.Command, args []string) error {
 			var err error
 			if config, err = parseConfig(args[0]); err != nil {
-				PrintFlagsError(runCmd, "<config>", err)
+				return PrintFlagsError(copyCmd, "<config>", err)
 			}
 
 			if len(args[1]) < 1 {
-				PrintFlagsError(copyCmd, "--source", fmt.Errorf("must be given"))
+				return PrintFlagsError(copyCmd, "<source>", fmt.Errorf("must be given"))
+			}
+			if len(args[2]) < 1 {
+				return PrintFlagsError(copyCmd, "<output>", fmt.Errorf("must be given"))
 			}
 
-			if _, err := os.Stat(args[2]); os.IsNotExist(err) {
-				if err := os.Mkdir(args[2], 0755); err != nil {
-					PrintFlagsError(copyCmd, "--output", err)
+			if flagCopyTo {
+				if _, err := os.Stat(args[1]); err != nil {
+					return PrintFlagsError(copyCmd, "<source>", err)
+				}
+			} else if _, err := os.Stat(args[2]); os.IsNotExist(err) {
+				if err := os.MkdirAll(args[2], 0755); err != nil {
+					return PrintFlagsError(copyCmd, "<output>", err)
 				}
 			}
 
 			flagSourceDirectory = args[1]
 			flagOutputDirectory = args[2]
 
-			parseCopyFlags()
+			if err = parseCopyFlags(); err != nil {
+				return err
+			}
+			hosts := filterDockerHosts(config.SelectHosts(flagNodes), flagHosts)
+			if err = connectHosts(hosts); err != nil {
+				return err
+			}
 
 			// get container info
 			containers := map[string][]types.Container{}
 			var numContainers int
-			for _, dh := range config.DockerHosts {
-				cl, err := findContainersByPrefix(dh.Client(), "scn.")
+			m := composer.NewNodeMatcher(flagNodes)
+			for _, dh := range hosts {
+				cl, err := composer.Containers(rootContext, dh, composerOptions())
 				if err != nil {
 					log.Error("failed to get containers", "error", err)
-					os.Exit(1)
+					return reported(exitCodeError, err)
 				}
-				if _, found := containers[dh.Host]; !found {
+				for _, c := range cl {
+					if m.Match(dh, GetContainerName(c.Names)) {
+						containers[dh.Host] = append(containers[dh.Host], c)
+						numContainers++
+					}
 				}
-				containers[dh.Host] = append(containers[dh.Host], cl...)
-				numContainers++
+			}
+			if err := m.Err(); err != nil {
+				return PrintFlagsError(copyCmd, "--node", err)
+			}
+
+			if numContainers < 1 {
+				return PrintError(copyCmd, fmt.Errorf("containers not found"))
 			}
 
 			var wg sync.WaitGroup
+			var lock sync.Mutex
 
 			var containerNames []string
 			for _, cls := range containers {
@@ -98,44 +154,88 @@ func init() {
 				}
 			}
 
+			sort.Strings(containerNames)
 			fmt.Printf("containers: %s\n", strings.Join(containerNames, ", "))
 
+			results := map[string]CopyResult{}
+			errs := map[string]error{}
+
 			wg.Add(len(containerNames))
 			for dhHost, cls := range containers {
 				dh, found := config.GetDockerHost(dhHost)
 				if !found {
-					PrintError(copyCmd, fmt.Errorf("unknown host key found: %s", dhHost))
+					return PrintError(copyCmd, fmt.Errorf("unknown host key found: %s", dhHost))
 				}
 				for _, c := range cls {
-					go func(c types.Container) {
+					go func(dh *DockerHost, c types.Container) {
 						defer wg.Done()
-						err := copyFromContainer(
-							dh.Client(),
-							c.ID,
-							flagSourceDirectory,
-							filepath.Join(flagOutputDirectory, GetContainerName(c.Names)),
-						)
-						if err != nil {
-							log.Error("failed to download source", "error", err)
+
+						name := GetContainerName(c.Names)
+
+						var result CopyResult
+						var err error
+						if flagCopyTo {
+							result, err = copyToContainer(dh.Client(), c.ID, flagSourceDirectory, flagOutputDirectory)
+						} else {
+							result, err = copyFromContainer(
+								dh.Client(),
+								c.ID,
+								flagSourceDirectory,
+								filepath.Join(flagOutputDirectory, name),
+								copyMode,
+							)
 						}
-					}(c)
+
+						lock.Lock()
+						results[name] = result
+						errs[name] = err
+						lock.Unlock()
+					}(dh, c)
 				}
 			}
 
 			ch := Ticker()
 			wg.Wait()
 			ch <- true
+
+			var failed bool
+			var total CopyResult
+			for _, name := range containerNames {
+				result := results[name]
+				if err := errs[name]; err != nil {
+					failed = true
+					log.Error("failed to copy", "container", name, "error", err)
+				}
+				for _, err := range result.Errors {
+					failed = true
+					log.Error("failed to copy file", "container", name, "error", err)
+				}
+
+				fmt.Printf("%s: %s\n", name, result)
+
+				total.Files += result.Files
+				total.Bytes += result.Bytes
+				total.Skipped += result.Skipped
+				total.Errors = append(total.Errors, result.Errors...)
+			}
+			fmt.Printf("total: %s\n", total)
+
+			if failed {
+				return reported(exitCodeError, fmt.Errorf("failed to copy"))
+			}
 			log.Debug("done")
+
+			return nil
 		},
 	}
 
 	var err error
 	var currentDirectory string
 	if currentDirectory, err = os.Getwd(); err != nil {
-		PrintFlagsError(copyCmd, "--ouptut-directory", err)
+		panic(err)
 	}
 	if currentDirectory, err = filepath.Abs(currentDirectory); err != nil {
-		PrintFlagsError(copyCmd, "--ouptut-directory", err)
+		panic(err)
 	}
 
 	copyCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
@@ -153,5 +253,12 @@ func init() {
 		"output directory",
 	)
 
+	copyCmd.Flags().BoolVar(&flagCopyTo, "to", flagCopyTo, "copy the local <source> into <output> path of the containers")
+	copyCmd.Flags().Var(&flagNodes, "node", "container name, node alias or node address to copy; can be given multiple times")
+	copyCmd.Flags().Var(&flagHosts, "host", "host name or host address to copy; can be given multiple times")
+	copyCmd.Flags().BoolVar(&flagCopyOverwrite, "overwrite", flagCopyOverwrite, "remove the existing local directory before copying")
+	copyCmd.Flags().BoolVar(&flagCopySkipExisting, "skip-existing", flagCopySkipExisting, "keep the existing local files")
+	copyCmd.Flags().BoolVar(&flagCopyMerge, "merge", flagCopyMerge, "copy into the existing local directory, replacing the same files")
+
 	rootCmd.AddCommand(copyCmd)
 }
@@ -1,224 +1,206 @@
 package cmd
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
-	"boscoin.io/sebak/lib/common"
 	"boscoin.io/sebak/lib/node"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/docker/pkg/system"
-	"github.com/docker/go-connections/nat"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
-func findContainersByPrefix(cli *client.Client, p string) (containers []types.Container, err error) {
-	ctx := context.Background()
-	var cl []types.Container
-	if cl, err = cli.ContainerList(ctx, types.ContainerListOptions{All: true}); err != nil {
-		log.Error("failed to get container list", "error", err)
-		return
-	}
+// removeHelperContainer removes the helper container; it is removed even
+// after the root context is canceled.
+func removeHelperContainer(dh *DockerHost, id string) error {
+	ctx, cancel := cleanupContext()
+	defer cancel()
 
-	for _, i := range cl {
-		for _, name := range i.Names {
-			if !strings.HasPrefix(name[1:], "scn.") {
-				continue
-			}
+	return composer.RemoveContainer(ctx, dh, id, composerOptions())
+}
 
-			containers = append(containers, i)
-			break
-		}
-	}
+func inspectContainer(dh *DockerHost, id string) (j types.ContainerJSON, err error) {
+	err = dh.Retry.Do(rootContext, func(ctx context.Context) (err error) {
+		ctx, cancel := dockerContextFrom(ctx)
+		defer cancel()
+
+		j, err = dh.Client().ContainerInspect(ctx, id)
+		return
+	})
 
 	return
 }
 
-func findContainer(cli *client.Client, s string) (c types.Container, err error) {
-	ctx := context.Background()
-	var cl []types.Container
-	if cl, err = cli.ContainerList(ctx, types.ContainerListOptions{All: true}); err != nil {
-		log.Error("failed to get container list", "error", err)
-		return
-	}
+func startContainer(cli *client.Client, id string) error {
+	ctx, cancel := dockerContext()
+	defer cancel()
 
-	for _, i := range cl {
-		for _, name := range i.Names {
-			if !strings.Contains(name[1:], s) {
-				continue
-			}
+	return cli.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
 
-			c = i
-			return
-		}
-	}
+func stopContainer(cli *client.Client, id string) error {
+	ctx, cancel := dockerContext()
+	defer cancel()
 
-	return
+	return cli.ContainerStop(ctx, id, nil)
 }
 
-func removeContainerByName(cli *client.Client, s string) (err error) {
-	var info types.Container
-	if info, err = findContainer(cli, s); err != nil {
+// prepareHelperImage builds the helper image, which has network tools like
+// iptables and tc, if it does not exist.
+func prepareHelperImage(dh *DockerHost) (imageID string, err error) {
+	if imageID, err = composer.FindImage(rootContext, dh, helperImageName, composerOptions()); err != nil {
 		return
-	}
-
-	if len(info.ID) < 1 {
+	} else if len(imageID) > 0 {
 		return
 	}
 
-	return removeContainerByID(cli, info.ID)
-}
+	dockerfile := []byte("FROM alpine:latest\nRUN apk add --no-cache iptables iproute2\n")
 
-func removeContainerByID(cli *client.Client, s string) (err error) {
-	err = cli.ContainerRemove(context.Background(), s, types.ContainerRemoveOptions{Force: true})
-	if err != nil {
-		log.Error("failed to remove container", "error", err, "container", s)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err = tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0644, Size: int64(len(dockerfile))}); err != nil {
 		return
 	}
-	log.Debug("container removed", "container", s)
-
-	return
-}
-
-func cleanDocker(cli *client.Client) (err error) {
-	ctx := context.Background()
-	var cl []types.Container
-	if cl, err = cli.ContainerList(ctx, types.ContainerListOptions{All: true}); err != nil {
-		log.Error("failed to get container list", "error", err)
+	if _, err = tw.Write(dockerfile); err != nil {
 		return
 	}
-
-	for _, c := range cl {
-		log.Debug("found container", "container", c)
-		for _, name := range c.Names {
-			if !strings.HasPrefix(name[1:], dockerContainerNamePrefix) {
-				continue
-			}
-
-			// remove container :)
-			if err = cli.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
-				log.Error("failed to remove container", "error", err, "container", c)
-				return
-			}
-			log.Debug("container removed", "container", c)
-		}
+	if err = tw.Close(); err != nil {
+		return
 	}
 
-	return
-}
-
-func findImage(cli *client.Client, s string) (id string, err error) {
-	ctx := context.Background()
-
-	var images []types.ImageSummary
-	if images, err = cli.ImageList(ctx, types.ImageListOptions{All: true}); err != nil {
-		log.Error("failed to get image list", "error", err)
+	resp, err := dh.Client().ImageBuild(
+		rootContext,
+		&buf,
+		types.ImageBuildOptions{Tags: []string{helperImageName}, Remove: true, Dockerfile: "Dockerfile"},
+	)
+	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
-	for _, i := range images {
-		for _, t := range i.RepoTags {
-			if strings.Contains(t, s) {
-				id = i.ID
-				return
-			}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var m struct {
+			Error string `json:"error"`
+		}
+		if e := dec.Decode(&m); e == io.EOF {
+			break
+		} else if e != nil {
+			err = e
+			return
+		}
+		if len(m.Error) > 0 {
+			err = fmt.Errorf("failed to build helper image: %s", m.Error)
+			return
 		}
 	}
 
+	if imageID, err = composer.FindImage(rootContext, dh, helperImageName, composerOptions()); err != nil {
+		return
+	} else if len(imageID) < 1 {
+		err = fmt.Errorf("failed to build helper image")
+	}
+
 	return
 }
 
-func removeImage(cli *client.Client, s string) (err error) {
-	var id string
-	if id, err = findImage(cli, s); err != nil {
+// writeContainerFile writes the content into the file, `p` of container; the
+// parent directory of `p` must exist in the container.
+func writeContainerFile(ctx context.Context, cli *client.Client, id, p string, content []byte) (err error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err = tw.WriteHeader(&tar.Header{Name: filepath.Base(p), Mode: 0644, Size: int64(len(content))}); err != nil {
 		return
 	}
-
-	if len(id) < 1 {
-		err = fmt.Errorf("image not found: '%s'", s)
+	if _, err = tw.Write(content); err != nil {
 		return
 	}
-
-	var resp []types.ImageDelete
-	resp, err = cli.ImageRemove(context.Background(), id, types.ImageRemoveOptions{})
-	if err != nil {
+	if err = tw.Close(); err != nil {
 		return
 	}
-	for _ = range resp {
-	}
 
-	return
+	ctx, cancel := dockerContextFrom(ctx)
+	defer cancel()
+
+	return cli.CopyToContainer(
+		ctx,
+		id,
+		filepath.Dir(p),
+		&buf,
+		types.CopyToContainerOptions{AllowOverwriteDirWithFile: false},
+	)
 }
 
-func pullImage(cli *client.Client, t string) (err error) {
-	var resp io.ReadCloser
-	resp, err = cli.ImagePull(
-		context.Background(),
-		t,
-		types.ImagePullOptions{},
+var reANSIEscape = regexp.MustCompile("\x1B\\[([0-9]{1,3}((;[0-9]{1,3})*)?)?[m|K]")
+
+// getContainerLogTail returns the last lines of container logs without the
+// terminal escape codes.
+func getContainerLogTail(cli *client.Client, id string, lines int) (tail string, err error) {
+	ctx, cancel := dockerContext()
+	defer cancel()
+
+	var out io.ReadCloser
+	out, err = cli.ContainerLogs(
+		ctx,
+		id,
+		types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Tail: fmt.Sprintf("%d", lines)},
 	)
 	if err != nil {
 		return
 	}
+	defer out.Close()
+
+	var b bytes.Buffer
+	if _, err = stdcopy.StdCopy(&b, &b, out); err != nil {
+		return
+	}
+	tail = reANSIEscape.ReplaceAllString(b.String(), "")
 
-	_, _ = ioutil.ReadAll(resp)
 	return
 }
 
-func runContainerGettingIP(cli *client.Client) (ip string, err error) {
+// runHelper runs the shell script in the helper container, which has
+// NET_ADMIN capability; with `networkMode`, "host" or "container:<id>", the
+// script can manipulate the network of host or container.
+func runHelper(dh *DockerHost, name, networkMode, script string) (output string, err error) {
+	cli := dh.Client()
+
 	var imageID string
-	if imageID, err = findImage(cli, "alpine:latest"); err != nil {
+	if imageID, err = prepareHelperImage(dh); err != nil {
 		return
 	}
 
-	if len(imageID) < 1 {
-		err = pullImage(cli, "docker.io/library/alpine:latest")
-		if err != nil {
-			return
-		}
-		if imageID, err = findImage(cli, "alpine:latest"); err != nil {
-			return
-		} else if len(imageID) < 1 {
-			err = fmt.Errorf("failed to pull alpine:latest")
-			return
-		}
-	}
-
-	containerName := "sebak-network-composer-get-ip"
-
-	if err = removeContainerByName(cli, containerName); err != nil {
+	containerName := fmt.Sprintf("sebak-network-composer-helper.%s", name)
+	if err = composer.RemoveContainerByName(rootContext, dh, containerName, composerOptions()); err != nil {
 		return
 	}
 
 	containerConfig := &container.Config{
-		Image:        imageID,
-		AttachStdin:  false,
-		AttachStdout: false,
-		Tty:          false,
-		OpenStdin:    false,
-		Entrypoint: []string{
-			"/bin/sh",
-			"-c",
-			"/sbin/ip route | grep '^default ' | sed -e 's/.* src //g' -e 's/ metric.*//g'",
-		},
+		Image:      imageID,
+		Tty:        false,
+		OpenStdin:  false,
+		Entrypoint: []string{"/bin/sh", "-c", script},
 	}
 	containerHostConfig := &container.HostConfig{
-		NetworkMode: "host",
-		//AutoRemove:  true,
+		NetworkMode: container.NetworkMode(networkMode),
+		CapAdd:      []string{"NET_ADMIN"},
 	}
 
-	ctx := context.Background()
+	ctx, cancel := dockerContext()
+	defer cancel()
 	var containerBody container.ContainerCreateCreatedBody
 	containerBody, err = cli.ContainerCreate(
 		ctx,
@@ -227,119 +209,72 @@ func runContainerGettingIP(cli *client.Client) (ip string, err error) {
 		&network.NetworkingConfig{},
 		containerName,
 	)
-
 	if err != nil {
 		log.Error("failed to create container", "error", err)
 		return
 	}
+	defer removeHelperContainer(dh, containerBody.ID)
 
 	if err = cli.ContainerStart(ctx, containerBody.ID, types.ContainerStartOptions{}); err != nil {
 		log.Error("failed to start container", "error", err)
 		return
 	}
-	defer removeContainerByID(cli, containerBody.ID)
 
-	if _, err = cli.ContainerWait(ctx, containerBody.ID); err != nil {
+	var exitCode int64
+	if exitCode, err = cli.ContainerWait(ctx, containerBody.ID); err != nil {
 		return
 	}
 
-	out, err := cli.ContainerLogs(ctx, containerBody.ID, types.ContainerLogsOptions{ShowStdout: true})
-	if err != nil {
-		panic(err)
+	var out io.ReadCloser
+	if out, err = cli.ContainerLogs(ctx, containerBody.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true}); err != nil {
+		return
 	}
+	defer out.Close()
 
-	var b []byte
-	if b, err = ioutil.ReadAll(out); err != nil {
+	var b bytes.Buffer
+	if _, err = stdcopy.StdCopy(&b, &b, out); err != nil {
 		return
 	}
+	output = b.String()
 
-	ip = strings.TrimSpace(string(b[8:]))
+	if exitCode != 0 {
+		err = fmt.Errorf("helper failed; exit code=%d: %s", exitCode, strings.TrimSpace(output))
+	}
 
 	return
 }
 
-func runSEBAK(dh *DockerHost, nd *node.LocalNode) (id string, err error) {
-	cli := dh.Client()
-
-	ctx := context.Background()
+// cleanPathContainerName is the name of helper container of
+// `cleanContainerPath`.
+const cleanPathContainerName string = "sebak-network-composer-clean-path"
 
-	var images []types.ImageSummary
-	if images, err = cli.ImageList(ctx, types.ImageListOptions{All: true}); err != nil {
-		log.Error("failed to get container list", "error", err)
-		return
-	}
-	if len(images) < 1 {
-		err = errors.New("image not found")
+// prepareCleanContainerPath prepares the image for `cleanContainerPath` and
+// removes the helper container, which is left by the previous run.
+func prepareCleanContainerPath(dh *DockerHost) (imageID string, err error) {
+	if imageID, err = composer.PrepareAlpineImage(rootContext, dh, composerOptions()); err != nil {
 		return
 	}
 
-	var imageID string
-	for _, i := range images {
-		if _, found := common.InStringArray(i.RepoTags, flagImageName); !found {
-			continue
-		}
-		imageID = i.ID
-		break
-	}
-
-	if len(imageID) < 1 {
-		err = fmt.Errorf("image not found")
-		log.Error("failed to find the image", "image", flagImageName, "error", err)
-		return
-	}
+	err = composer.RemoveContainerByName(rootContext, dh, cleanPathContainerName, composerOptions())
 
-	var env_validators []string
-	for _, v := range nd.GetValidators() {
-		s := fmt.Sprintf("%s?address=%s", v.Endpoint(), v.Address())
-		env_validators = append(env_validators, s)
-	}
-
-	_, port, _ := net.SplitHostPort(nd.Endpoint().Host)
-	bindEndpoint, _ := common.NewEndpointFromString(nd.Endpoint().String())
-	bindEndpoint.Host = fmt.Sprintf("0.0.0.0:%s", port)
-
-	envs := []string{
-		fmt.Sprintf("SEBAK_NODE_ALIAS=%s", nd.Alias()),
-		"SEBAK_TLS_CERT=/sebak.crt",
-		"SEBAK_TLS_KEY=/sebak.key",
-		fmt.Sprintf("SEBAK_LOG_LEVEL=%s", flagSebakLogLevel),
-		fmt.Sprintf("SEBAK_SECRET_SEED=%s", nd.Keypair().Seed()),
-		fmt.Sprintf("SEBAK_NETWORK_ID=%s", networkID),
-		fmt.Sprintf("SEBAK_BIND=%s", bindEndpoint.String()),
-		fmt.Sprintf("SEBAK_PUBLISH=%s", nd.Endpoint().String()),
-		fmt.Sprintf("SEBAK_GENESIS_BLOCK=%s", config.Genesis),
-		fmt.Sprintf("SEBAK_COMMON_ACCOUNT=%s", config.Common),
-		fmt.Sprintf("SEBAK_VALIDATORS=self %s", strings.Join(env_validators, " ")),
-	}
-	envs = append(envs, dh.Env...)
+	return
+}
 
-	var mounts []mount.Mount
-	for _, v := range dh.Volume {
-		m := mount.Mount{Type: mount.TypeBind, Source: v.Source, Target: v.Target}
-		mounts = append(mounts, m)
-	}
+// cleanContainerPath removes everything under the given path of the container
+// by running helper container, which shares the volumes of the container, so
+// it works even if the container is not running. The image is prepared by
+// `prepareCleanContainerPath`.
+func cleanContainerPath(ctx context.Context, dh *DockerHost, imageID, containerID, p string) (err error) {
+	cli := dh.Client()
 
 	containerConfig := &container.Config{
-		Image:        imageID,
-		AttachStdin:  false,
-		AttachStdout: false,
-		ExposedPorts: nat.PortSet{nat.Port(port): {}},
-		Tty:          false,
-		OpenStdin:    false,
-		Entrypoint:   []string{"/bin/sh", "/entrypoint.sh"},
-		Env:          envs,
+		Image:      imageID,
+		Tty:        false,
+		OpenStdin:  false,
+		Entrypoint: []string{"/usr/bin/find", p, "-mindepth", "1", "-delete"},
 	}
 	containerHostConfig := &container.HostConfig{
-		Mounts: mounts,
-		PortBindings: nat.PortMap{
-			nat.Port(fmt.Sprintf("%d/tcp", basePort)): []nat.PortBinding{
-				{
-					HostIP:   "0.0.0.0",
-					HostPort: port,
-				},
-			},
-		},
-		NetworkMode: "host",
+		VolumesFrom: []string{containerID},
 	}
 
 	var containerBody container.ContainerCreateCreatedBody
@@ -348,43 +283,150 @@ func runSEBAK(dh *DockerHost, nd *node.LocalNode) (id string, err error) {
 		containerConfig,
 		containerHostConfig,
 		&network.NetworkingConfig{},
-		makeContainerName(nd),
+		cleanPathContainerName,
 	)
 	if err != nil {
 		log.Error("failed to create container", "error", err)
 		return
 	}
+	defer removeHelperContainer(dh, containerBody.ID)
 
 	if err = cli.ContainerStart(ctx, containerBody.ID, types.ContainerStartOptions{}); err != nil {
 		log.Error("failed to start container", "error", err)
 		return
 	}
 
-	id = containerBody.ID
+	var exitCode int64
+	if exitCode, err = cli.ContainerWait(ctx, containerBody.ID); err != nil {
+		return
+	} else if exitCode != 0 {
+		err = fmt.Errorf("failed to clean path, '%s'; exit code=%d", p, exitCode)
+		return
+	}
+
+	return
+}
+
+// getContainerEnv returns the value of environment variable from the
+// container.
+func getContainerEnv(j types.ContainerJSON, key string) (string, bool) {
+	return composer.ContainerEnv(j, key)
+}
+
+// getPublishEndpoint returns the endpoint of the node, which can be accessed
+// from composer.
+func getPublishEndpoint(dh *DockerHost, j types.ContainerJSON) (string, error) {
+	return composer.PublishEndpoint(dh, j)
+}
+
+// getContainerStats returns the one-shot resource usage of container.
+func getContainerStats(cli *client.Client, containerID string) (stats types.StatsJSON, err error) {
+	ctx, cancel := dockerContext()
+	defer cancel()
+
+	var resp types.ContainerStats
+	if resp, err = cli.ContainerStats(ctx, containerID, false); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+
+	return
+}
+
+// cpuPercent calculates the cpu usage of container like `docker stats`.
+func cpuPercent(stats types.StatsJSON) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	// the per-cpu usage is empty in cgroup v2; it is counted as one cpu
+	cpus := len(stats.CPUStats.CPUUsage.PercpuUsage)
+	if cpus < 1 {
+		cpus = 1
+	}
+
+	return cpuDelta / systemDelta * float64(cpus) * 100
+}
+
+// networkIO returns the received and transmitted bytes of all the networks of
+// container.
+func networkIO(stats types.StatsJSON) (rx, tx uint64) {
+	for _, n := range stats.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+
+	return
+}
+
+// blockIO returns the read and written bytes of the block devices of
+// container.
+func blockIO(stats types.StatsJSON) (read, write uint64) {
+	for _, e := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
+		}
+	}
 
 	return
 }
 
 func makeContainerName(nd *node.LocalNode) string {
-	return fmt.Sprintf("%s%s", dockerContainerNamePrefix, nd.Alias()[:4])
+	return composer.ContainerName(nd)
+}
+
+type CopyMode int
+
+const (
+	CopyModeDefault CopyMode = iota
+	CopyModeOverwrite
+	CopyModeSkipExisting
+	CopyModeMerge
+)
+
+// CopyResult is the summary of copying files from or to container.
+type CopyResult struct {
+	Files   int
+	Bytes   int64
+	Skipped int
+	Errors  []error
+}
+
+func (r CopyResult) String() string {
+	return fmt.Sprintf("files=%d bytes=%d skipped=%d errors=%d", r.Files, r.Bytes, r.Skipped, len(r.Errors))
 }
 
-func copyFromContainer(cli *client.Client, containerID, srcPath, destPath string) error {
+func copyFromContainer(cli *client.Client, containerID, srcPath, destPath string, mode CopyMode) (result CopyResult, err error) {
 	if absPath, err := filepath.Abs(destPath); err != nil {
-		return err
+		return result, err
 	} else {
 		destPath = archive.PreserveTrailingDotOrSeparator(absPath, destPath)
 	}
 
 	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
-		return fmt.Errorf("destPath already exists: '%s'", destPath)
+		switch mode {
+		case CopyModeOverwrite:
+			if err := os.RemoveAll(destPath); err != nil {
+				return result, err
+			}
+		case CopyModeSkipExisting, CopyModeMerge:
+		default:
+			return result, fmt.Errorf("destPath already exists: '%s'", destPath)
+		}
 	}
 	if err := os.MkdirAll(destPath, os.FileMode(0755)); err != nil {
-		return err
+		return result, err
 	}
 
 	var rebaseName string
-	ctx, _ := context.WithCancel(context.Background())
+	ctx := rootContext
 	srcStat, err := cli.ContainerStatPath(ctx, containerID, srcPath)
 	if err == nil && srcStat.Mode&os.ModeSymlink != 0 {
 		linkTarget := srcStat.LinkTarget
@@ -397,26 +439,160 @@ func copyFromContainer(cli *client.Client, containerID, srcPath, destPath string
 		srcPath = linkTarget
 	}
 
-	reader, stat, err := cli.CopyFromContainer(context.Background(), containerID, srcPath)
+	reader, _, err := cli.CopyFromContainer(ctx, containerID, srcPath)
 	if err != nil {
-		return err
+		return result, err
 	}
 	defer reader.Close()
 
-	srcInfo := archive.CopyInfo{
-		Path:       srcPath,
-		Exists:     true,
-		IsDir:      stat.Mode.IsDir(),
-		RebaseName: rebaseName,
+	preArchive := reader
+	if len(rebaseName) != 0 {
+		_, srcBase := archive.SplitPathDirEntry(srcPath)
+		preArchive = archive.RebaseArchiveEntries(reader, srcBase, rebaseName)
 	}
 
-	preArchive := reader
-	if len(srcInfo.RebaseName) != 0 {
-		_, srcBase := archive.SplitPathDirEntry(srcInfo.Path)
-		preArchive = archive.RebaseArchiveEntries(reader, srcBase, srcInfo.RebaseName)
+	return extractArchive(preArchive, destPath, mode)
+}
+
+// extractArchive extracts the tar archive into the directory. Unlike
+// `archive.CopyTo`, the error of each entry does not stop extracting and is
+// collected in the result.
+func extractArchive(r io.Reader, destPath string, mode CopyMode) (result CopyResult, err error) {
+	tr := tar.NewReader(r)
+	for {
+		var hdr *tar.Header
+		if hdr, err = tr.Next(); err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+
+		target := filepath.Join(destPath, filepath.Clean("/"+hdr.Name))
+		if e := extractArchiveEntry(tr, hdr, target, mode, &result); e != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("'%s': %v", hdr.Name, e))
+		}
 	}
 
-	archive.CopyTo(preArchive, srcInfo, destPath)
+	return
+}
+
+func extractArchiveEntry(r io.Reader, hdr *tar.Header, target string, mode CopyMode, result *CopyResult) error {
+	fi := hdr.FileInfo()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, fi.Mode().Perm()|0700)
+	case tar.TypeReg, tar.TypeRegA, tar.TypeSymlink:
+	default:
+		return fmt.Errorf("unsupported file type: %v", hdr.Typeflag)
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		if mode == CopyModeSkipExisting {
+			result.Skipped++
+			return nil
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if hdr.Typeflag == tar.TypeSymlink {
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+		result.Files++
+		return nil
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+
+	result.Files++
+	result.Bytes += n
 
 	return nil
 }
+
+func copyToContainer(cli *client.Client, containerID, srcPath, destPath string) (result CopyResult, err error) {
+	if absPath, err := filepath.Abs(srcPath); err != nil {
+		return result, err
+	} else {
+		srcPath = archive.PreserveTrailingDotOrSeparator(absPath, srcPath)
+	}
+
+	ctx := rootContext
+
+	destInfo := archive.CopyInfo{Path: destPath}
+	destStat, err := cli.ContainerStatPath(ctx, containerID, destPath)
+	if err == nil && destStat.Mode&os.ModeSymlink != 0 {
+		linkTarget := destStat.LinkTarget
+		if !system.IsAbs(linkTarget) {
+			destParent, _ := archive.SplitPathDirEntry(destPath)
+			linkTarget = filepath.Join(destParent, linkTarget)
+		}
+
+		destInfo.Path = linkTarget
+		destStat, err = cli.ContainerStatPath(ctx, containerID, linkTarget)
+	}
+
+	// if the destination does not exist, assume the parent directory exists;
+	// `CopyToContainer` will fail if not.
+	if err == nil {
+		destInfo.Exists, destInfo.IsDir = true, destStat.Mode.IsDir()
+	}
+
+	srcInfo, err := archive.CopyInfoSourcePath(srcPath, true)
+	if err != nil {
+		return
+	}
+
+	err = filepath.Walk(srcInfo.Path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			result.Files++
+			result.Bytes += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	srcArchive, err := archive.TarResource(srcInfo)
+	if err != nil {
+		return
+	}
+	defer srcArchive.Close()
+
+	destDir, preparedArchive, err := archive.PrepareArchiveCopy(srcArchive, srcInfo, destInfo)
+	if err != nil {
+		return
+	}
+	defer preparedArchive.Close()
+
+	err = cli.CopyToContainer(
+		ctx,
+		containerID,
+		destDir,
+		preparedArchive,
+		types.CopyToContainerOptions{AllowOverwriteDirWithFile: false},
+	)
+
+	return
+}
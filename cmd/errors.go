@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	exitCodeError             int = 1
+	exitCodeDiverged          int = 2
+	exitCodeLagging           int = 3
+	exitCodeHostUnreachable   int = 4
+	exitCodeImageMissing      int = 5
+	exitCodeContainerConflict int = 6
+	exitCodeNodeUnhealthy     int = 7
+)
+
+// reportedError is the error, which is already reported by the command, like
+// the invalid flag with help or the failed result; `Execute` exits with the
+// code without printing it again.
+type reportedError struct {
+	code int
+	err  error
+}
+
+func (e *reportedError) Error() string {
+	return e.err.Error()
+}
+
+// reported marks the error as reported; the command exits with the code.
+func reported(code int, err error) error {
+	return &reportedError{code: code, err: err}
+}
+
+// exitCodeOf returns the exit code by the category of error; if the
+// aggregated errors have different categories, it is exitCodeError.
+func exitCodeOf(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return 0
+	case *reportedError:
+		return e.code
+	case MultiError:
+		var code int
+		for _, err := range e {
+			c := exitCodeOf(err)
+			if code != 0 && c != code {
+				return exitCodeError
+			}
+			code = c
+		}
+		return code
+	case *HostUnreachableError:
+		return exitCodeHostUnreachable
+	case *ImageMissingError:
+		return exitCodeImageMissing
+	case *ContainerConflictError:
+		return exitCodeContainerConflict
+	case *NodeUnhealthyError:
+		return exitCodeNodeUnhealthy
+	default:
+		return exitCodeError
+	}
+}
+
+// printError prints the error summary, unless it is already reported, and
+// returns the exit code of error.
+func printError(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if _, ok := err.(*reportedError); !ok {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+
+	return exitCodeOf(err)
+}
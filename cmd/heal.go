@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	healCmd *cobra.Command
+)
+
+func healPartition() (failed bool) {
+	nodes, err := findNetworkNodes(config.DockerHosts)
+	if err != nil {
+		log.Error("failed to get containers", "error", err)
+		return true
+	}
+
+	// without groups, every unit just removes the rules
+	units, _ := planPartition(nodes, nil)
+	if _, failed = runPartitionUnits(units, func(partitionUnit) string { return healPartitionScript }); failed {
+		return
+	}
+
+	state, err := loadState()
+	if err != nil {
+		log.Error("failed to load state", "error", err)
+		return true
+	}
+
+	state.Partition = nil
+	if err = state.Save(); err != nil {
+		log.Error("failed to save state", "error", err)
+		return true
+	}
+
+	return
+}
+
+func init() {
+	healCmd = &cobra.Command{
+		Use:   "heal <config>",
+		Short: "remove the network partition of sebak nodes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(healCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			ch := Ticker()
+			failed := healPartition()
+			ch <- true
+
+			if failed {
+				return reported(exitCodeError, fmt.Errorf("failed to heal partition"))
+			}
+			log.Debug("done")
+
+			return nil
+		},
+	}
+
+	healCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+
+	rootCmd.AddCommand(healCmd)
+}
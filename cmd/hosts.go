@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	units "github.com/docker/go-units"
+	isatty "github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+var (
+	hostsCmd *cobra.Command
+)
+
+// HostStatus is the status of docker daemon of host.
+type HostStatus struct {
+	Name          string   `json:"name"`
+	Host          string   `json:"host"`
+	Reachable     bool     `json:"reachable"`
+	Error         string   `json:"error,omitempty"`
+	Version       string   `json:"version,omitempty"`
+	APIVersion    string   `json:"api-version,omitempty"`
+	OS            string   `json:"os,omitempty"`
+	Arch          string   `json:"arch,omitempty"`
+	CPUs          int      `json:"cpus,omitempty"`
+	Memory        int64    `json:"memory,omitempty"`
+	Containers    int      `json:"containers"`
+	Running       int      `json:"running"`
+	ContainerList []string `json:"container-list,omitempty"`
+}
+
+func getHostStatus(dh *DockerHost) (status HostStatus, err error) {
+	cli := dh.Client()
+
+	ctx, cancel := dockerContext()
+	defer cancel()
+
+	var version types.Version
+	if version, err = cli.ServerVersion(ctx); err != nil {
+		return
+	}
+
+	var info types.Info
+	if info, err = cli.Info(ctx); err != nil {
+		return
+	}
+
+	var cl []types.Container
+	if cl, err = composer.Containers(rootContext, dh, composerOptions()); err != nil {
+		return
+	}
+
+	status.Version = version.Version
+	status.APIVersion = version.APIVersion
+	status.OS = info.OperatingSystem
+	status.Arch = version.Arch
+	status.CPUs = info.NCPU
+	status.Memory = info.MemTotal
+	status.Containers = len(cl)
+	for _, c := range cl {
+		if c.State == "running" {
+			status.Running++
+		}
+		status.ContainerList = append(status.ContainerList, GetContainerName(c.Names))
+	}
+
+	return
+}
+
+// getHostStatuses connects to the docker hosts concurrently and collects the
+// status of the reachable ones.
+func getHostStatuses(hosts []*DockerHost) []HostStatus {
+	errs := composer.ConnectHosts(rootContext, hosts, flagDockerTimeout)
+
+	statuses := make([]HostStatus, len(hosts))
+
+	var wg sync.WaitGroup
+	wg.Add(len(hosts))
+	for i, dh := range hosts {
+		go func(i int, dh *DockerHost) {
+			defer wg.Done()
+
+			err := errs[i]
+			var status HostStatus
+			if err == nil {
+				status, err = getHostStatus(dh)
+			}
+
+			status.Name = dh.Name
+			status.Host = dh.Host
+			status.Reachable = err == nil
+			if err != nil {
+				status.Error = err.Error()
+			}
+			statuses[i] = status
+		}(i, dh)
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+func printHostStatuses(statuses []HostStatus) {
+	header := []string{
+		"host", "address", "status", "version", "api", "os", "cpus", "memory", "containers",
+	}
+
+	var rows [][]string
+	var highlighted []bool
+	for _, s := range statuses {
+		if !s.Reachable {
+			rows = append(rows, []string{s.Name, s.Host, "UNREACHABLE", "-", "-", "-", "-", "-", "-"})
+			highlighted = append(highlighted, true)
+			continue
+		}
+
+		rows = append(rows, []string{
+			s.Name,
+			s.Host,
+			"ok",
+			s.Version,
+			s.APIVersion,
+			fmt.Sprintf("%s/%s", s.OS, s.Arch),
+			fmt.Sprintf("%d", s.CPUs),
+			units.BytesSize(float64(s.Memory)),
+			fmt.Sprintf("%d/%d", s.Running, s.Containers),
+		})
+		highlighted = append(highlighted, false)
+	}
+
+	printTable(os.Stdout, header, rows, highlighted, isatty.IsTerminal(os.Stdout.Fd()))
+
+	for _, s := range statuses {
+		if !s.Reachable {
+			fmt.Printf("%s: %s\n", s.Name, s.Error)
+		}
+	}
+}
+
+func init() {
+	hostsCmd = &cobra.Command{
+		Use:   "hosts <config>",
+		Short: "show the reachability and status of docker hosts",
+		Long: `show the reachability and status of docker hosts
+
+The docker hosts are connected concurrently; for the reachable ones, docker
+version, api version, os, cpus, memory and sebak containers, running/total are
+shown. If any host is unreachable, it exits with 1.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(hostsCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+
+			switch flagOutput {
+			case "table", "json":
+			default:
+				return PrintFlagsError(hostsCmd, "--output", fmt.Errorf("unknown output format, '%s'", flagOutput))
+			}
+
+			statuses := getHostStatuses(config.DockerHosts)
+
+			if flagOutput == "json" {
+				b, _ := json.MarshalIndent(statuses, "", "  ")
+				fmt.Println(string(b))
+			} else {
+				printHostStatuses(statuses)
+			}
+
+			for _, s := range statuses {
+				if !s.Reachable {
+					return reported(exitCodeError, fmt.Errorf("host, '%s' is unreachable; %s", s.Name, s.Error))
+				}
+			}
+
+			return nil
+		},
+	}
+
+	hostsCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	hostsCmd.Flags().StringVar(&flagOutput, "output", flagOutput, "output format, {table, json}")
+
+	rootCmd.AddCommand(hostsCmd)
+}
@@ -2,22 +2,28 @@ package cmd
 
 import (
 	"os"
+	"time"
 
 	logging "github.com/inconshreveable/log15"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 const (
-	basePort                  int    = 12345
-	baseContainerPort         int    = 12000
-	networkID                 string = "test sebak-network"
-	dockerContainerNamePrefix string = "scn."
+	basePort                  int    = composer.BasePort
+	baseContainerPort         int    = composer.BaseContainerPort
+	networkID                 string = composer.NetworkID
+	dockerContainerNamePrefix string = composer.ContainerNamePrefix
+	apiBlocksPath             string = "/api/v1/blocks"
+	apiAccountsPath           string = "/api/v1/accounts"
+	apiTransactionsPath       string = "/api/v1/transactions"
 )
 
 const (
 	defaultLogLevel        logging.Lvl = logging.LvlInfo
 	defaultSebakLogLevel   logging.Lvl = logging.LvlDebug
-	defaultDockerImageName string      = "boscoin/sebak-network-composer:latest"
+	defaultDockerImageName string      = composer.DefaultImage
+	helperImageName        string      = "sebak-network-composer-helper:latest"
 )
 
 var (
@@ -25,22 +31,72 @@ var (
 	config         *Config
 	maxLogsVerbose int64 = 10000
 
-	flagLogLevel        string = defaultLogLevel.String()
-	flagSebakLogLevel   string = defaultSebakLogLevel.String()
-	flagImageName       string = defaultDockerImageName
-	flagForceClean      bool   = false
-	flagBuildFromSource bool
-	flagVerbose         bool
-	flagSourceDirectory string
-	flagOutputDirectory string
-	flagLogsSince       string
-	flagLogsTail        string
-	flagLogsHead        string
+	flagLogLevel             string = defaultLogLevel.String()
+	flagSebakLogLevel        string = defaultSebakLogLevel.String()
+	flagImageName            string = defaultDockerImageName
+	flagForceClean           bool   = false
+	flagBuildFromSource      bool
+	flagVerbose              bool
+	flagSourceDirectory      string
+	flagOutputDirectory      string
+	flagLogsSince            string
+	flagLogsTail             string
+	flagLogsHead             string
+	flagCopyTo               bool
+	flagCopyOverwrite        bool
+	flagCopySkipExisting     bool
+	flagCopyMerge            bool
+	flagNodes                ListFlags
+	flagHosts                ListFlags
+	flagLive                 bool
+	flagSnapshotPath         string = "./snapshots"
+	flagStoragePath          string
+	flagOutput               string = "table"
+	flagCheckFrom            uint64
+	flagCheckTo              uint64
+	flagLagThreshold         uint64 = 2
+	flagWatch                bool
+	flagWatchInterval        time.Duration = time.Second * 2
+	flagListen               string        = ":9100"
+	flagStatsDuration        time.Duration = time.Minute
+	flagStatsInterval        time.Duration = time.Second * 5
+	flagStatsExport          string
+	flagPartitionGroups      string
+	flagNetemPeers           ListFlags
+	flagNetemDelay           time.Duration
+	flagNetemJitter          time.Duration
+	flagNetemLoss            float64
+	flagNetemDuplicate       float64
+	flagNetemRate            string
+	flagChaosDuration        time.Duration = time.Minute * 5
+	flagChaosInterval        time.Duration = time.Second * 10
+	flagChaosSeed            int64
+	flagChaosMaxFaulty       int = -1
+	flagChaosActions         ListFlags
+	flagChaosRecoveryTimeout time.Duration = time.Minute
+	flagLoadAccounts         int           = 10
+	flagLoadRate             float64
+	flagLoadDuration         time.Duration = time.Minute
+	flagLoadInterval         time.Duration = 5 * time.Second
+	flagLoadAmount           uint64        = 1000000000
+	flagLoadConfirmTimeout   time.Duration = time.Minute
+	flagAllNodes             bool
+	flagReport               string
+	flagTimeout              time.Duration
+	flagDockerTimeout        time.Duration = time.Minute
+	flagHTTPTimeout          time.Duration = 10 * time.Second
+	flagSkipUnreachable      bool
 )
 
 var rootCmd = &cobra.Command{
 	Use:   os.Args[0],
 	Short: "sebak-network-composer",
+	PersistentPreRun: func(c *cobra.Command, args []string) {
+		commandStarted = true
+		setupRootContext()
+	},
+	SilenceErrors: true,
+	SilenceUsage:  true,
 	Run: func(c *cobra.Command, args []string) {
 		if len(args) < 1 {
 			c.Usage()
@@ -48,9 +104,35 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+func init() {
+	rootCmd.PersistentFlags().DurationVar(&flagTimeout, "timeout", flagTimeout, "timeout of the whole command; 0 is no timeout")
+	rootCmd.PersistentFlags().DurationVar(&flagDockerTimeout, "docker-timeout", flagDockerTimeout, "timeout of each docker call, except the long running ones like build and copy")
+	rootCmd.PersistentFlags().DurationVar(&flagHTTPTimeout, "http-timeout", flagHTTPTimeout, "timeout of each http request to sebak node")
+	rootCmd.PersistentFlags().BoolVar(&flagSkipUnreachable, "skip-unreachable", flagSkipUnreachable, "continue with the reachable docker hosts, instead of failing when any of them is unreachable")
+}
+
+// commandStarted is set when the arguments and flags are parsed and the
+// command starts; the error before is the usage error.
+var commandStarted bool
+
+// execute runs the command and returns the error of command; the usage error
+// is printed with the help.
+func execute() error {
+	commandStarted = false
+
+	c, err := rootCmd.ExecuteC()
+	if err != nil && !commandStarted {
+		err = PrintError(c, err)
+	}
+
+	return err
+}
+
+// Execute runs the command and exits with the exit code of the returned
+// error; the commands return the error instead of exiting.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		PrintFlagsError(rootCmd, "", err)
+	if err := execute(); err != nil {
+		os.Exit(printError(err))
 	}
 }
 
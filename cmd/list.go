@@ -3,12 +3,12 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 var (
@@ -20,22 +20,27 @@ func init() {
 		Use:   "list <config>",
 		Short: "list sebak containers",
 		Args:  cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, args []string) {
+		RunE: func(c *cobra.Command, args []string) error {
 			var err error
 			if config, err = parseConfig(args[0]); err != nil {
-				PrintFlagsError(runCmd, "<config>", err)
+				return PrintFlagsError(listCmd, "<config>", err)
 			}
 
-			parseStartFlags()
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
 
 			// get container info
 			containers := map[string][]types.Container{}
 			var numContainers int
 			for _, dh := range config.DockerHosts {
-				cl, err := findContainersByPrefix(dh.Client(), "scn.")
+				cl, err := composer.Containers(rootContext, dh, composerOptions())
 				if err != nil {
 					log.Error("failed to get containers", "error", err)
-					os.Exit(1)
+					return reported(exitCodeError, err)
 				}
 				if _, found := containers[dh.Host]; !found {
 				}
@@ -52,11 +57,12 @@ func init() {
 
 			sort.Strings(containerNames)
 			fmt.Printf("containers: %s\n", strings.Join(containerNames, ", "))
+			printState()
 
 			for dhHost, cls := range containers {
 				dh, found := config.GetDockerHost(dhHost)
 				if !found {
-					PrintError(stopCmd, fmt.Errorf("unknown host key found: %s", dhHost))
+					return PrintError(stopCmd, fmt.Errorf("unknown host key found: %s", dhHost))
 				}
 				for _, c := range cls {
 					b, _ := json.MarshalIndent(c, "", "  ")
@@ -67,6 +73,8 @@ func init() {
 			}
 
 			log.Debug("done")
+
+			return nil
 		},
 	}
 
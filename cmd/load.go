@@ -0,0 +1,504 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/common/keypair"
+	"boscoin.io/sebak/lib/transaction"
+	"boscoin.io/sebak/lib/transaction/operation"
+	isatty "github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// loadFundBatchSize is the number of create-account operations in one
+	// funding transaction.
+	loadFundBatchSize int = 100
+	// loadPaymentAmount is the amount of each payment, in GON.
+	loadPaymentAmount common.Amount = 1
+	// loadPollInterval is the interval to check the transaction is confirmed.
+	loadPollInterval time.Duration = 500 * time.Millisecond
+	// loadMaxRate is the maximum of `--rate`; the payments are paced by the
+	// ticker of `1s / rate`, which must not be shorter than a microsecond.
+	loadMaxRate float64 = 1000000
+)
+
+var (
+	loadCmd *cobra.Command
+)
+
+// LoadTick is the progress of load in every interval.
+type LoadTick struct {
+	Elapsed   time.Duration `json:"elapsed"`
+	Submitted int           `json:"submitted"`
+	Accepted  int           `json:"accepted"`
+	Confirmed int           `json:"confirmed"`
+	Failed    int           `json:"failed"`
+	TPS       float64       `json:"tps"`
+}
+
+// LoadReport is the result of load.
+type LoadReport struct {
+	Accounts  int                `json:"accounts"`
+	Duration  time.Duration      `json:"duration"`
+	Submitted int                `json:"submitted"`
+	Accepted  int                `json:"accepted"`
+	Confirmed int                `json:"confirmed"`
+	Failed    int                `json:"failed"`
+	TPS       float64            `json:"tps"`
+	Latency   map[string]float64 `json:"latency"`
+	Timeline  []LoadTick         `json:"timeline"`
+
+	latencies []float64
+}
+
+func (r *LoadReport) summarize() {
+	sort.Float64s(r.latencies)
+
+	r.Latency = map[string]float64{}
+	for _, p := range []float64{50, 90, 95, 99, 100} {
+		r.Latency[fmt.Sprintf("p%v", p)] = percentile(r.latencies, p)
+	}
+
+	if r.Duration > 0 {
+		r.TPS = float64(r.Confirmed) / r.Duration.Seconds()
+	}
+}
+
+func (r LoadReport) Print() {
+	fmt.Printf(
+		"accounts=%d duration=%s submitted=%d accepted=%d confirmed=%d failed=%d tps=%.2f\n",
+		r.Accounts, r.Duration, r.Submitted, r.Accepted, r.Confirmed, r.Failed, r.TPS,
+	)
+
+	header := []string{"latency", "p50", "p90", "p95", "p99", "max"}
+	row := []string{"confirm"}
+	for _, p := range []string{"p50", "p90", "p95", "p99", "p100"} {
+		row = append(row, fmt.Sprintf("%.3fs", r.Latency[p]))
+	}
+	printTable(os.Stdout, header, [][]string{row}, []bool{false}, false)
+}
+
+// loadAccount is the funded account, which sends payments; the account can
+// have only one pending transaction, because the sequence id is increased
+// after the transaction is confirmed.
+type loadAccount struct {
+	kp         *keypair.Full
+	sequenceID uint64
+}
+
+// Load submits the payment transactions between the funded accounts across
+// the node endpoints.
+type Load struct {
+	sync.Mutex
+	endpoints []string
+	accounts  []*loadAccount
+	next      int
+	report    LoadReport
+}
+
+func (l *Load) endpoint() string {
+	l.Lock()
+	defer l.Unlock()
+
+	e := l.endpoints[l.next%len(l.endpoints)]
+	l.next++
+
+	return e
+}
+
+func (l *Load) count(f func(r *LoadReport)) {
+	l.Lock()
+	defer l.Unlock()
+
+	f(&l.report)
+}
+
+func newSignedTransaction(kp *keypair.Full, sequenceID uint64, ops ...operation.Operation) (tx transaction.Transaction, err error) {
+	if tx, err = transaction.NewTransaction(kp.Address(), sequenceID, ops...); err != nil {
+		return
+	}
+	tx.Sign(kp, []byte(networkID))
+
+	return
+}
+
+func submitTransaction(endpoint string, tx transaction.Transaction) (err error) {
+	var b []byte
+	if b, err = json.Marshal(tx); err != nil {
+		return
+	}
+
+	_, err = HTTPPost(strings.TrimRight(endpoint, "/")+apiTransactionsPath, b)
+
+	return
+}
+
+// waitTransaction waits until the transaction is stored in block.
+func waitTransaction(endpoint, hash string, timeout time.Duration) (err error) {
+	u := fmt.Sprintf("%s%s/%s", strings.TrimRight(endpoint, "/"), apiTransactionsPath, hash)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err = HTTPGet(u); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("transaction not confirmed in %s: %v", timeout, err)
+			return
+		}
+		if !sleep(loadPollInterval) {
+			err = rootContext.Err()
+			return
+		}
+	}
+}
+
+// fundAccounts creates the accounts from genesis account.
+func fundAccounts(endpoint string, genesis *keypair.Full, n int, amount common.Amount) (accounts []*loadAccount, err error) {
+	for i := 0; i < n; i++ {
+		accounts = append(accounts, &loadAccount{kp: keypair.Random()})
+	}
+
+	for i := 0; i < n; i += loadFundBatchSize {
+		var ops []operation.Operation
+		for _, a := range accounts[i:minInt(i+loadFundBatchSize, n)] {
+			var op operation.Operation
+			if op, err = operation.MakeOperation(operation.NewCreateAccount(a.kp.Address(), amount, "")); err != nil {
+				return
+			}
+			ops = append(ops, op)
+		}
+
+		var g AccountInfo
+		if g, err = getAccount(endpoint, genesis.Address()); err != nil {
+			err = fmt.Errorf("failed to get genesis account: %v", err)
+			return
+		}
+
+		var tx transaction.Transaction
+		if tx, err = newSignedTransaction(genesis, g.SequenceID, ops...); err != nil {
+			return
+		}
+		if err = submitTransaction(endpoint, tx); err != nil {
+			return
+		}
+		if err = waitTransaction(endpoint, tx.GetHash(), flagLoadConfirmTimeout); err != nil {
+			return
+		}
+		log.Debug("accounts funded", "accounts", len(ops), "transaction", tx.GetHash())
+	}
+
+	return
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// pay sends one payment from the account and waits until it is confirmed.
+func (l *Load) pay(a *loadAccount) {
+	target := l.accounts[rand.Intn(len(l.accounts))]
+	for target == a && len(l.accounts) > 1 {
+		target = l.accounts[rand.Intn(len(l.accounts))]
+	}
+
+	endpoint := l.endpoint()
+
+	op, err := operation.MakeOperation(operation.NewPayment(target.kp.Address(), loadPaymentAmount))
+	if err != nil {
+		log.Error("failed to make payment", "error", err)
+		return
+	}
+	tx, err := newSignedTransaction(a.kp, a.sequenceID, op)
+	if err != nil {
+		log.Error("failed to make transaction", "error", err)
+		return
+	}
+
+	started := time.Now()
+	l.count(func(r *LoadReport) { r.Submitted++ })
+
+	if err = submitTransaction(endpoint, tx); err != nil {
+		l.count(func(r *LoadReport) { r.Failed++ })
+		log.Debug("failed to submit transaction", "endpoint", endpoint, "error", err)
+		l.refresh(endpoint, a)
+		return
+	}
+	l.count(func(r *LoadReport) { r.Accepted++ })
+
+	if err = waitTransaction(endpoint, tx.GetHash(), flagLoadConfirmTimeout); err != nil {
+		l.count(func(r *LoadReport) { r.Failed++ })
+		log.Debug("transaction not confirmed", "endpoint", endpoint, "transaction", tx.GetHash(), "error", err)
+		l.refresh(endpoint, a)
+		return
+	}
+
+	latency := time.Since(started).Seconds()
+	l.count(func(r *LoadReport) {
+		r.Confirmed++
+		r.latencies = append(r.latencies, latency)
+	})
+	a.sequenceID++
+}
+
+// refresh reloads the sequence id of account after failure.
+func (l *Load) refresh(endpoint string, a *loadAccount) {
+	if !sleep(loadPollInterval) {
+		return
+	}
+
+	if ac, err := getAccount(endpoint, a.kp.Address()); err == nil {
+		a.sequenceID = ac.SequenceID
+	}
+}
+
+// Run sends payments during the duration; if rate is 0, every account sends
+// the next payment as soon as the previous one is confirmed.
+func (l *Load) Run(duration time.Duration, rate float64, interval time.Duration) {
+	stop := make(chan bool)
+	var tokens chan bool
+	if rate > 0 {
+		tokens = make(chan bool, len(l.accounts))
+		go func() {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					select {
+					case tokens <- true:
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	started := time.Now()
+	reported := make(chan bool)
+	go func() {
+		defer close(reported)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last int
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				l.Lock()
+				t := LoadTick{
+					Elapsed:   time.Since(started),
+					Submitted: l.report.Submitted,
+					Accepted:  l.report.Accepted,
+					Confirmed: l.report.Confirmed,
+					Failed:    l.report.Failed,
+					TPS:       float64(l.report.Confirmed-last) / interval.Seconds(),
+				}
+				last = l.report.Confirmed
+				l.report.Timeline = append(l.report.Timeline, t)
+				l.Unlock()
+
+				log.Info(
+					"load",
+					"elapsed", t.Elapsed.Round(time.Second),
+					"submitted", t.Submitted,
+					"accepted", t.Accepted,
+					"confirmed", t.Confirmed,
+					"failed", t.Failed,
+					"tps", fmt.Sprintf("%.2f", t.TPS),
+				)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(len(l.accounts))
+	for _, a := range l.accounts {
+		go func(a *loadAccount) {
+			defer wg.Done()
+			for {
+				if tokens != nil {
+					select {
+					case <-stop:
+						return
+					case <-tokens:
+					}
+				} else {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+				}
+				l.pay(a)
+			}
+		}(a)
+	}
+
+	sleep(duration)
+	close(stop)
+	wg.Wait()
+	<-reported
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.report.Accounts = len(l.accounts)
+	l.report.Duration = time.Since(started)
+	l.report.summarize()
+}
+
+// runLoad funds the accounts and sends payments across the running nodes.
+func runLoad(genesis *keypair.Full, accounts int, rate float64, duration, interval time.Duration) (report LoadReport, err error) {
+	var targets []NodeTarget
+	if targets, err = findNodeTargets(config.DockerHosts); err != nil {
+		return
+	}
+	if len(targets) < 1 {
+		err = fmt.Errorf("containers not found")
+		return
+	}
+
+	l := &Load{}
+	for _, t := range targets {
+		l.endpoints = append(l.endpoints, t.Endpoint)
+	}
+
+	log.Info("funding accounts", "accounts", accounts)
+	ch := Ticker()
+	l.accounts, err = fundAccounts(l.endpoints[0], genesis, accounts, common.Amount(flagLoadAmount))
+	ch <- true
+	if err != nil {
+		err = fmt.Errorf("failed to fund accounts: %v", err)
+		return
+	}
+
+	log.Info("sending payments", "duration", duration, "rate", rate)
+	l.Run(duration, rate, interval)
+
+	report = l.report
+	return
+}
+
+func parseLoadFlags() (genesis *keypair.Full, err error) {
+	if err = parseStartFlags(); err != nil {
+		return
+	}
+
+	switch flagOutput {
+	case "table", "json":
+	default:
+		return nil, PrintFlagsError(loadCmd, "--output", fmt.Errorf("unknown output format, '%s'", flagOutput))
+	}
+
+	if flagLoadAccounts < 1 {
+		return nil, PrintFlagsError(loadCmd, "--accounts", fmt.Errorf("must be greater than 0"))
+	}
+	if math.IsNaN(flagLoadRate) || flagLoadRate < 0 || flagLoadRate > loadMaxRate {
+		return nil, PrintFlagsError(loadCmd, "--rate", fmt.Errorf("must be between 0 and %v", loadMaxRate))
+	}
+	if flagLoadRate > 0 && flagLoadRate < 1/float64(flagLoadDuration/time.Second+1) {
+		return nil, PrintFlagsError(loadCmd, "--rate", fmt.Errorf("too small to send any payment during the duration"))
+	}
+	if flagLoadDuration <= 0 {
+		return nil, PrintFlagsError(loadCmd, "--duration", fmt.Errorf("must be greater than 0"))
+	}
+	if flagLoadInterval <= 0 {
+		return nil, PrintFlagsError(loadCmd, "--interval", fmt.Errorf("must be greater than 0"))
+	}
+
+	if genesis, err = config.GenesisKeypair(); err != nil {
+		return nil, PrintFlagsError(loadCmd, "<config>", err)
+	}
+
+	return
+}
+
+func init() {
+	loadCmd = &cobra.Command{
+		Use:   "load <config>",
+		Short: "send payment transactions to sebak nodes",
+		Long: `send payment transactions to sebak nodes
+
+The accounts are created from the genesis account and they send payments to
+each other at the target rate across the node endpoints. The progress is
+printed in every interval and the latency until the transaction is stored in
+block is reported. The genesis seed must be set in the config.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(loadCmd, "<config>", err)
+			}
+
+			var genesis *keypair.Full
+			if genesis, err = parseLoadFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			report, err := runLoad(genesis, flagLoadAccounts, flagLoadRate, flagLoadDuration, flagLoadInterval)
+			if err != nil {
+				log.Error("failed to load", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			if flagOutput == "json" {
+				b, _ := json.MarshalIndent(report, "", "  ")
+				fmt.Println(string(b))
+				return nil
+			}
+
+			header := []string{"elapsed", "submitted", "accepted", "confirmed", "failed", "tps"}
+			var rows [][]string
+			var highlighted []bool
+			for _, t := range report.Timeline {
+				rows = append(rows, []string{
+					t.Elapsed.Round(time.Second).String(),
+					fmt.Sprintf("%d", t.Submitted),
+					fmt.Sprintf("%d", t.Accepted),
+					fmt.Sprintf("%d", t.Confirmed),
+					fmt.Sprintf("%d", t.Failed),
+					fmt.Sprintf("%.2f", t.TPS),
+				})
+				highlighted = append(highlighted, t.TPS == 0)
+			}
+			printTable(os.Stdout, header, rows, highlighted, isatty.IsTerminal(os.Stdout.Fd()))
+			fmt.Println()
+			report.Print()
+
+			return nil
+		},
+	}
+
+	loadCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	loadCmd.Flags().StringVar(&flagOutput, "output", flagOutput, "output format, {table, json}")
+	loadCmd.Flags().IntVar(&flagLoadAccounts, "accounts", flagLoadAccounts, "number of accounts to send payments")
+	loadCmd.Flags().Uint64Var(&flagLoadAmount, "amount", flagLoadAmount, "initial balance of accounts in GON")
+	loadCmd.Flags().Float64Var(&flagLoadRate, "rate", flagLoadRate, "target transactions per second; 0 is maximum throughput")
+	loadCmd.Flags().DurationVar(&flagLoadDuration, "duration", flagLoadDuration, "duration of load")
+	loadCmd.Flags().DurationVar(&flagLoadInterval, "interval", flagLoadInterval, "interval to report the progress")
+	loadCmd.Flags().DurationVar(&flagLoadConfirmTimeout, "confirm-timeout", flagLoadConfirmTimeout, "timeout to wait the transaction is confirmed")
+
+	rootCmd.AddCommand(loadCmd)
+}
@@ -1,34 +1,29 @@
 package cmd
 
 import (
-	"bufio"
-	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 var (
 	logsCmd *cobra.Command
 )
 
-func parseLogsFlags() {
+func parseLogsFlags() error {
 	{
 		var err error
 		var logLevel logging.Lvl
 		if logLevel, err = logging.LvlFromString(flagLogLevel); err != nil {
-			fmt.Printf("invalid `log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `log-level`: %v", err)
 		}
 
 		var formatter logging.Format
@@ -46,47 +41,15 @@ func parseLogsFlags() {
 	{
 		var err error
 		if _, err = logging.LvlFromString(flagSebakLogLevel); err != nil {
-			fmt.Printf("invalid `sebak-log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `sebak-log-level`: %v", err)
 		}
 	}
 
 	if _, err := os.Stat(flagOutputDirectory); os.IsNotExist(err) {
 		if err := os.Mkdir(flagOutputDirectory, 0755); err != nil {
-			PrintFlagsError(logsCmd, "--output-directory", err)
+			return PrintFlagsError(logsCmd, "--output-directory", err)
 		}
 	}
-}
-
-func getContainerLogs(cli *client.Client, id, path string) error {
-	reader, err := cli.ContainerLogs(context.Background(), id, types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Since:      flagLogsSince,
-		Tail:       flagLogsTail,
-	})
-	if err != nil {
-		return err
-	}
-
-	output, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		b := scanner.Bytes()
-		if len(b) < 8 {
-			b = []byte{}
-		} else {
-			b = b[8:]
-		}
-		output.Write(append(b, []byte("\n")...))
-	}
-	if err := scanner.Err(); err != nil {
-		return err
-	}
 
 	return nil
 }
@@ -96,64 +59,32 @@ func init() {
 		Use:   "logs <config>",
 		Short: "logs sebak containers",
 		Args:  cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, args []string) {
+		RunE: func(c *cobra.Command, args []string) error {
 			var err error
 			if config, err = parseConfig(args[0]); err != nil {
-				PrintFlagsError(runCmd, "<config>", err)
-			}
-
-			parseLogsFlags()
-
-			// get container info
-			containers := map[string][]types.Container{}
-			var numContainers int
-			for _, dh := range config.DockerHosts {
-				cl, err := findContainersByPrefix(dh.Client(), "scn.")
-				if err != nil {
-					log.Error("failed to get containers", "error", err)
-					os.Exit(1)
-				}
-				if _, found := containers[dh.Host]; !found {
-				}
-				containers[dh.Host] = append(containers[dh.Host], cl...)
-				numContainers++
+				return PrintFlagsError(logsCmd, "<config>", err)
 			}
 
-			var wg sync.WaitGroup
-
-			var containerNames []string
-			for _, cls := range containers {
-				for _, c := range cls {
-					containerNames = append(containerNames, GetContainerName(c.Names))
-				}
+			if err = parseLogsFlags(); err != nil {
+				return err
 			}
-
-			fmt.Printf("containers: %s\n", strings.Join(containerNames, ", "))
-
-			wg.Add(len(containerNames))
-			for dhHost, cls := range containers {
-				dh, found := config.GetDockerHost(dhHost)
-				if !found {
-					PrintError(logsCmd, fmt.Errorf("unknown host key found: %s", dhHost))
-				}
-				for _, c := range cls {
-					go func(c types.Container) {
-						defer wg.Done()
-						err := getContainerLogs(
-							dh.Client(),
-							c.ID,
-							filepath.Join(flagOutputDirectory, GetContainerName(c.Names)+".log"),
-						)
-						if err != nil {
-							log.Error("failed to download logs", "error", err)
-						}
-					}(c)
-				}
+			if _, err = connectNodeHosts(flagNodes); err != nil {
+				return err
 			}
 
 			ch := Ticker()
-			wg.Wait()
+			containerNames, err := composer.Logs(rootContext, config, flagOutputDirectory, composer.LogsOptions{
+				Options: composerOptions(),
+				Nodes:   flagNodes,
+				Since:   flagLogsSince,
+				Tail:    flagLogsTail,
+			})
 			ch <- true
+
+			fmt.Printf("containers: %s\n", strings.Join(containerNames, ", "))
+			if err != nil {
+				log.Error("failed to download logs", "error", err)
+			}
 			log.Debug("done")
 
 			if flagVerbose {
@@ -184,16 +115,22 @@ func init() {
 					fmt.Fprintf(os.Stdout, "%s", string(buf))
 				}
 			}
+
+			if err != nil {
+				return reported(exitCodeError, err)
+			}
+
+			return nil
 		},
 	}
 
 	var err error
 	var currentDirectory string
 	if currentDirectory, err = os.Getwd(); err != nil {
-		PrintFlagsError(logsCmd, "--ouptut-directory", err)
+		panic(err)
 	}
 	if currentDirectory, err = filepath.Abs(currentDirectory); err != nil {
-		PrintFlagsError(logsCmd, "--ouptut-directory", err)
+		panic(err)
 	}
 
 	logsCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
@@ -207,6 +144,7 @@ func init() {
 	logsCmd.Flags().BoolVar(&flagVerbose, "verbose", flagVerbose, "verbose")
 	logsCmd.Flags().StringVar(&flagLogsTail, "tail", flagLogsTail, "tail")
 	logsCmd.Flags().StringVar(&flagLogsHead, "head", flagLogsHead, "head")
+	logsCmd.Flags().Var(&flagNodes, "node", "host name, container name, node alias or node address to get logs; can be given multiple times")
 
 	rootCmd.AddCommand(logsCmd)
 }
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+var (
+	metricsCmd *cobra.Command
+)
+
+type metricSample struct {
+	labels []string
+	value  float64
+}
+
+type metric struct {
+	name    string
+	typ     string
+	help    string
+	samples []metricSample
+}
+
+// metricSet collects the samples and writes them in the text format of
+// prometheus.
+type metricSet struct {
+	sync.Mutex
+	metrics map[string]*metric
+}
+
+func newMetricSet() *metricSet {
+	return &metricSet{metrics: map[string]*metric{}}
+}
+
+// Add adds new sample; labels are the pairs of label name and value.
+func (ms *metricSet) Add(name, typ, help string, value float64, labels ...string) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	m, found := ms.metrics[name]
+	if !found {
+		m = &metric{name: name, typ: typ, help: help}
+		ms.metrics[name] = m
+	}
+
+	m.samples = append(m.samples, metricSample{labels: labels, value: value})
+}
+
+// write writes the metrics in the text format of prometheus.
+func (ms *metricSet) write(w io.Writer) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	var names []string
+	for name := range ms.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for _, name := range names {
+		m := ms.metrics[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+
+		for _, s := range m.samples {
+			var labels []string
+			for i := 0; i+1 < len(s.labels); i += 2 {
+				labels = append(labels, fmt.Sprintf(`%s="%s"`, s.labels[i], escape.Replace(s.labels[i+1])))
+			}
+			fmt.Fprintf(w, "%s{%s} %v\n", m.name, strings.Join(labels, ","), s.value)
+		}
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func collectContainerMetrics(ms *metricSet, dh *DockerHost, c types.Container) {
+	name := GetContainerName(c.Names)
+
+	j, err := inspectContainer(dh, c.ID)
+	if err != nil {
+		log.Error("failed to inspect container", "container", name, "error", err)
+		return
+	}
+
+	// every series of container has the same labels whether the node
+	// responds or not; the alias is from the container, not from the node.
+	alias, _ := getContainerEnv(j, "SEBAK_NODE_ALIAS")
+	labels := []string{"host", dh.Name, "container", name, "alias", alias}
+
+	running := j.State != nil && j.State.Running
+	ms.Add("sebak_container_running", "gauge", "whether the container is running", boolToFloat(running), labels...)
+	ms.Add("sebak_container_restart_count", "gauge", "number of restarts of the container", float64(j.RestartCount), labels...)
+
+	if !running {
+		return
+	}
+
+	var info NodeInfo
+	var up bool
+	if endpoint, err := getPublishEndpoint(dh, j); err != nil {
+		log.Error("failed to get endpoint", "container", name, "error", err)
+	} else if info, err = getNodeInfo(endpoint); err != nil {
+		log.Debug("failed to get node info", "container", name, "error", err)
+	} else {
+		up = true
+	}
+
+	ms.Add("sebak_node_up", "gauge", "whether the node info endpoint responds", boolToFloat(up), labels...)
+	if up {
+		ms.Add("sebak_block_height", "gauge", "latest block height", float64(info.Block.Height), labels...)
+		ms.Add("sebak_block_total_txs", "gauge", "total number of transactions", float64(info.Block.TotalTxs), labels...)
+		ms.Add("sebak_block_total_ops", "gauge", "total number of operations", float64(info.Block.TotalOps), labels...)
+		ms.Add(
+			"sebak_node_state", "gauge", "consensus state of the node",
+			1, append(labels, "state", info.Node.State)...,
+		)
+	}
+
+	stats, err := getContainerStats(dh.Client(), c.ID)
+	if err != nil {
+		log.Error("failed to get container stats", "container", name, "error", err)
+		return
+	}
+
+	rx, tx := networkIO(stats)
+	ms.Add(
+		"sebak_container_cpu_usage_seconds_total", "counter", "total cpu time consumed by the container",
+		float64(stats.CPUStats.CPUUsage.TotalUsage)/1e9, labels...,
+	)
+	ms.Add("sebak_container_cpu_percent", "gauge", "cpu usage of the container in percent", cpuPercent(stats), labels...)
+	ms.Add("sebak_container_memory_usage_bytes", "gauge", "memory usage of the container", float64(stats.MemoryStats.Usage), labels...)
+	ms.Add("sebak_container_memory_limit_bytes", "gauge", "memory limit of the container", float64(stats.MemoryStats.Limit), labels...)
+	ms.Add("sebak_container_network_receive_bytes_total", "counter", "received bytes of the container", float64(rx), labels...)
+	ms.Add("sebak_container_network_transmit_bytes_total", "counter", "transmitted bytes of the container", float64(tx), labels...)
+}
+
+func collectMetrics() *metricSet {
+	ms := newMetricSet()
+
+	var wg sync.WaitGroup
+	for _, dh := range config.DockerHosts {
+		cl, err := composer.Containers(rootContext, dh, composerOptions())
+		ms.Add("sebak_host_up", "gauge", "whether the docker host responds", boolToFloat(err == nil), "host", dh.Name)
+		if err != nil {
+			log.Error("failed to get containers", "host", dh.Name, "error", err)
+			continue
+		}
+
+		wg.Add(len(cl))
+		for _, c := range cl {
+			go func(dh *DockerHost, c types.Container) {
+				defer wg.Done()
+				collectContainerMetrics(ms, dh, c)
+			}(dh, c)
+		}
+	}
+	wg.Wait()
+
+	return ms
+}
+
+func init() {
+	metricsCmd = &cobra.Command{
+		Use:   "metrics <config>",
+		Short: "export the metrics of sebak containers for prometheus",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(metricsCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+				collectMetrics().write(w)
+			})
+
+			log.Info("starting metrics server", "listen", flagListen)
+			server := &http.Server{Addr: flagListen, Handler: mux}
+			go func() {
+				<-rootContext.Done()
+
+				ctx, cancel := cleanupContext()
+				defer cancel()
+				server.Shutdown(ctx)
+			}()
+
+			if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("failed to run metrics server", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			return nil
+		},
+	}
+
+	metricsCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	metricsCmd.Flags().StringVar(&flagListen, "listen", flagListen, "address to listen")
+
+	rootCmd.AddCommand(metricsCmd)
+}
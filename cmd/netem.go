@@ -0,0 +1,423 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// netemDevicesScript sets $DEVS to the network devices, which route to the
+// target addresses; in host network mode, they are the docker network
+// devices, not the default route device, and `lo` for the nodes of same host.
+const netemDevicesScript string = "DEVS=$(for IP in %s; do ip route get $IP; done | sed -n 's/.* dev \\([^ ]*\\).*/\\1/p' | sort -u)"
+
+var (
+	netemCmd      *cobra.Command
+	netemClearCmd *cobra.Command
+
+	reNetemRate = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([kmgt]?(bit|bps))$`)
+)
+
+type NetemOptions struct {
+	Delay     time.Duration `json:"delay,omitempty"`
+	Jitter    time.Duration `json:"jitter,omitempty"`
+	Loss      float64       `json:"loss,omitempty"`
+	Duplicate float64       `json:"duplicate,omitempty"`
+	Rate      string        `json:"rate,omitempty"`
+}
+
+func (o NetemOptions) Validate() error {
+	switch {
+	case o.Delay < 0 || o.Jitter < 0:
+		return fmt.Errorf("delay and jitter must not be negative")
+	case o.Jitter > 0 && o.Delay == 0:
+		return fmt.Errorf("jitter needs delay")
+	case o.Loss < 0 || o.Loss > 100 || o.Duplicate < 0 || o.Duplicate > 100:
+		return fmt.Errorf("loss and duplicate must be percent, 0-100")
+	case len(o.Rate) > 0 && !reNetemRate.MatchString(o.Rate):
+		return fmt.Errorf("invalid rate, '%s'; it should be like '1mbit'", o.Rate)
+	case len(o.Args()) < 1:
+		return fmt.Errorf("at least one of delay, loss, duplicate and rate is needed")
+	}
+
+	return nil
+}
+
+// Args returns the arguments of `tc qdisc ... netem`.
+func (o NetemOptions) Args() string {
+	var args []string
+	if o.Delay > 0 {
+		args = append(args, fmt.Sprintf("delay %dus", o.Delay/time.Microsecond))
+		if o.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%dus", o.Jitter/time.Microsecond))
+		}
+	}
+	if o.Loss > 0 {
+		args = append(args, fmt.Sprintf("loss %v%%", o.Loss))
+	}
+	if o.Duplicate > 0 {
+		args = append(args, fmt.Sprintf("duplicate %v%%", o.Duplicate))
+	}
+	if len(o.Rate) > 0 {
+		args = append(args, fmt.Sprintf("rate %s", o.Rate))
+	}
+
+	return strings.Join(args, " ")
+}
+
+type NetemState struct {
+	Options NetemOptions `json:"options"`
+	Peers   []string     `json:"peers,omitempty"`
+	Created time.Time    `json:"created"`
+}
+
+func (n NetemState) String() string {
+	s := n.Options.Args()
+	if len(n.Peers) > 0 {
+		s += fmt.Sprintf(" to %s", strings.Join(n.Peers, ","))
+	}
+
+	return fmt.Sprintf("%s (since %s)", s, n.Created.Format(time.RFC3339))
+}
+
+// netemUnit is the network namespace where netem is applied; it is the node
+// container, or the host in host network mode. The helper container joins the
+// namespace by the node container.
+type netemUnit struct {
+	Name        string
+	Host        *DockerHost
+	NetworkMode string
+}
+
+func netemUnits(nodes []NetworkNode) (units []netemUnit) {
+	if !config.Network.IsHost() {
+		for _, n := range nodes {
+			units = append(units, netemUnit{Name: n.Container, Host: n.Host, NetworkMode: n.NetworkMode()})
+		}
+		return
+	}
+
+	// in host network mode, the nodes of same host share the network
+	seen := map[*DockerHost]bool{}
+	for _, n := range nodes {
+		if seen[n.Host] {
+			continue
+		}
+		seen[n.Host] = true
+		units = append(units, netemUnit{Name: n.Host.Name, Host: n.Host, NetworkMode: fmt.Sprintf("container:%s", n.ID)})
+	}
+
+	return
+}
+
+// netemTargets returns the publish endpoints of nodes.
+func netemTargets(nodes []NetworkNode) (targets []*url.URL) {
+	for _, n := range nodes {
+		if n.Publish != nil {
+			targets = append(targets, n.Publish)
+		}
+	}
+
+	return
+}
+
+func netemTargetIPs(targets []*url.URL) string {
+	seen := map[string]bool{}
+	var ips []string
+	for _, t := range targets {
+		ip, _, _ := net.SplitHostPort(t.Host)
+		if len(ip) < 1 || seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	return strings.Join(ips, " ")
+}
+
+// netemScript applies netem to the egress of the devices, which route to the
+// targets. If filter is true, only the traffic to the targets is affected;
+// otherwise all the traffic of the devices.
+func netemScript(o NetemOptions, targets []*url.URL, filter bool) string {
+	lines := []string{
+		"set -e",
+		fmt.Sprintf(netemDevicesScript, netemTargetIPs(targets)),
+	}
+	if !filter {
+		// the node itself is routed by lo
+		lines = append(lines, `DEVS=$(echo $DEVS | tr ' ' '\n' | grep -vx lo || true)`)
+	}
+	lines = append(
+		lines,
+		`test -n "$DEVS"`,
+		"for DEV in $DEVS; do",
+		"tc qdisc del dev $DEV root 2>/dev/null || true",
+	)
+
+	if !filter {
+		lines = append(lines, fmt.Sprintf("tc qdisc add dev $DEV root netem %s", o.Args()), "done")
+		return strings.Join(lines, "\n")
+	}
+
+	// the default traffic goes to the bands 1:1-1:3 by priomap and only the
+	// traffic to targets goes to 1:4, which has netem.
+	lines = append(
+		lines,
+		"tc qdisc add dev $DEV root handle 1: prio bands 4",
+		fmt.Sprintf("tc qdisc add dev $DEV parent 1:4 handle 40: netem %s", o.Args()),
+	)
+	for _, t := range targets {
+		ip, port, _ := net.SplitHostPort(t.Host)
+		lines = append(lines, fmt.Sprintf(
+			"tc filter add dev $DEV parent 1:0 protocol ip prio 1 u32 match ip dst %s/32 match ip dport %s 0xffff flowid 1:4",
+			ip, port,
+		))
+	}
+	lines = append(lines, "done")
+
+	return strings.Join(lines, "\n")
+}
+
+// clearNetemScript removes netem from the devices, which route to the
+// targets.
+func clearNetemScript(targets []*url.URL) string {
+	return strings.Join([]string{
+		fmt.Sprintf(netemDevicesScript, netemTargetIPs(targets)),
+		"for DEV in $DEVS; do tc qdisc del dev $DEV root 2>/dev/null || true; done",
+	}, "\n")
+}
+
+func runNetemUnits(units []netemUnit, script string) (failed []string) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(units))
+	for _, u := range units {
+		go func(u netemUnit) {
+			defer wg.Done()
+
+			if _, err := runHelper(u.Host, u.Name, u.NetworkMode, script); err != nil {
+				lock.Lock()
+				failed = append(failed, u.Name)
+				lock.Unlock()
+				log.Error("failed to run tc", "target", u.Name, "error", err)
+				return
+			}
+			log.Debug("tc applied", "target", u.Name)
+		}(u)
+	}
+	wg.Wait()
+
+	return
+}
+
+func init() {
+	netemCmd = &cobra.Command{
+		Use:   "netem <config>",
+		Short: "inject latency, packet loss and bandwidth limit to sebak nodes",
+		Long: `inject latency, packet loss and bandwidth limit to sebak nodes
+
+tc netem is applied to the outgoing traffic of the selected nodes by the helper
+container; with '--peer', only the traffic to the peer nodes is affected. In
+host network mode, it is applied to all the nodes of the host and only the
+traffic to the nodes is affected.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(netemCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			// without '--peer', netem is applied to the devices to all the
+			// nodes, so all the hosts are needed.
+			var hosts []*DockerHost
+			var selectors []string
+			if len(flagNodes) > 0 && len(flagNetemPeers) > 0 {
+				selectors = append(append(selectors, flagNodes...), flagNetemPeers...)
+			}
+			if hosts, err = connectNodeHosts(selectors); err != nil {
+				return err
+			}
+
+			options := NetemOptions{
+				Delay:     flagNetemDelay,
+				Jitter:    flagNetemJitter,
+				Loss:      flagNetemLoss,
+				Duplicate: flagNetemDuplicate,
+				Rate:      flagNetemRate,
+			}
+			if err = options.Validate(); err != nil {
+				return PrintFlagsError(netemCmd, "--delay, --jitter, --loss, --duplicate, --rate", err)
+			}
+
+			var nodes []NetworkNode
+			if nodes, err = findNetworkNodes(hosts); err != nil {
+				log.Error("failed to get containers", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			selected := nodes
+			if len(flagNodes) > 0 {
+				if selected, err = selectNetworkNodes(nodes, flagNodes); err != nil {
+					return PrintFlagsError(netemCmd, "--node", err)
+				}
+			}
+
+			// without '--peer', the devices to all the nodes are affected; in
+			// host network mode, only the traffic to the nodes is affected not
+			// to delay the other traffic of host, like docker API.
+			targets := netemTargets(nodes)
+			filter := config.Network.IsHost()
+			var peerNames []string
+			if len(flagNetemPeers) > 0 {
+				var peers []NetworkNode
+				if peers, err = selectNetworkNodes(nodes, flagNetemPeers); err != nil {
+					return PrintFlagsError(netemCmd, "--peer", err)
+				}
+				for _, p := range peers {
+					peerNames = append(peerNames, p.Container)
+				}
+				targets = netemTargets(peers)
+				filter = true
+			}
+			if len(targets) < 1 {
+				return PrintError(netemCmd, fmt.Errorf("no node endpoint to apply"))
+			}
+
+			units := netemUnits(selected)
+
+			ch := Ticker()
+			failed := runNetemUnits(units, netemScript(options, targets, filter))
+			ch <- true
+
+			state, err := loadState()
+			if err != nil {
+				log.Error("failed to load state", "error", err)
+				return reported(exitCodeError, err)
+			}
+			if state.Netem == nil {
+				state.Netem = map[string]NetemState{}
+			}
+
+			failedUnits := map[string]bool{}
+			for _, name := range failed {
+				failedUnits[name] = true
+			}
+
+			// only the units, which netem is applied to are recorded
+			var names []string
+			for _, u := range units {
+				if failedUnits[u.Name] {
+					continue
+				}
+				names = append(names, u.Name)
+				state.Netem[u.Name] = NetemState{Options: options, Peers: peerNames, Created: time.Now()}
+			}
+			if err = state.Save(); err != nil {
+				log.Error("failed to save state", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			sort.Strings(names)
+			if len(names) > 0 {
+				fmt.Printf("netem: %s: %s\n", strings.Join(names, ", "), options.Args())
+			}
+			if len(failed) > 0 {
+				return reported(exitCodeError, fmt.Errorf("failed to apply netem to %s", strings.Join(failed, ", ")))
+			}
+
+			return nil
+		},
+	}
+
+	netemClearCmd = &cobra.Command{
+		Use:   "clear <config>",
+		Short: "remove netem from sebak nodes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(netemClearCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			var nodes []NetworkNode
+			if nodes, err = findNetworkNodes(config.DockerHosts); err != nil {
+				log.Error("failed to get containers", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			selected := nodes
+			if len(flagNodes) > 0 {
+				if selected, err = selectNetworkNodes(nodes, flagNodes); err != nil {
+					return PrintFlagsError(netemClearCmd, "--node", err)
+				}
+			}
+
+			units := netemUnits(selected)
+
+			ch := Ticker()
+			failed := runNetemUnits(units, clearNetemScript(netemTargets(nodes)))
+			ch <- true
+
+			state, err := loadState()
+			if err != nil {
+				log.Error("failed to load state", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			failedUnits := map[string]bool{}
+			for _, name := range failed {
+				failedUnits[name] = true
+			}
+			for _, u := range units {
+				if !failedUnits[u.Name] {
+					delete(state.Netem, u.Name)
+				}
+			}
+			if err = state.Save(); err != nil {
+				log.Error("failed to save state", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			if len(failed) > 0 {
+				return reported(exitCodeError, fmt.Errorf("failed to clear netem of %s", strings.Join(failed, ", ")))
+			}
+			log.Debug("done")
+
+			return nil
+		},
+	}
+
+	netemCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	netemCmd.Flags().Var(&flagNodes, "node", "host name, container name, node alias or node address to apply; can be given multiple times")
+	netemCmd.Flags().Var(&flagNetemPeers, "peer", "apply only to the traffic to the node; can be given multiple times")
+	netemCmd.Flags().DurationVar(&flagNetemDelay, "delay", flagNetemDelay, "delay, like 100ms")
+	netemCmd.Flags().DurationVar(&flagNetemJitter, "jitter", flagNetemJitter, "jitter of delay, like 10ms")
+	netemCmd.Flags().Float64Var(&flagNetemLoss, "loss", flagNetemLoss, "packet loss in percent")
+	netemCmd.Flags().Float64Var(&flagNetemDuplicate, "duplicate", flagNetemDuplicate, "packet duplication in percent")
+	netemCmd.Flags().StringVar(&flagNetemRate, "rate", flagNetemRate, "bandwidth limit, like 1mbit")
+
+	netemClearCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	netemClearCmd.Flags().Var(&flagNodes, "node", "host name, container name, node alias or node address to clear; can be given multiple times")
+
+	netemCmd.AddCommand(netemClearCmd)
+	rootCmd.AddCommand(netemCmd)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+// NetworkNode is the running node container, whose network can be
+// manipulated.
+type NetworkNode struct {
+	Host      *DockerHost
+	ID        string
+	Container string
+	Alias     string
+	Publish   *url.URL
+}
+
+// Match checks whether the selector points the node; see
+// `composer.MatchNode`.
+func (n NetworkNode) Match(s string) bool {
+	return composer.MatchNode(s, n.Host, n.Container)
+}
+
+// NetworkMode returns the network mode for the helper container to share the
+// network namespace of node.
+func (n NetworkNode) NetworkMode() string {
+	if config.Network.IsHost() {
+		return "host"
+	}
+
+	return fmt.Sprintf("container:%s", n.ID)
+}
+
+func findNetworkNodes(hosts []*DockerHost) (nodes []NetworkNode, err error) {
+	for _, dh := range hosts {
+		var cl []types.Container
+		if cl, err = composer.Containers(rootContext, dh, composerOptions()); err != nil {
+			return
+		}
+
+		for _, c := range cl {
+			if c.State != "running" {
+				continue
+			}
+
+			var j types.ContainerJSON
+			if j, err = inspectContainer(dh, c.ID); err != nil {
+				return
+			}
+
+			n := NetworkNode{Host: dh, ID: c.ID, Container: GetContainerName(c.Names)}
+			n.Alias, _ = getContainerEnv(j, "SEBAK_NODE_ALIAS")
+			if publish, found := getContainerEnv(j, "SEBAK_PUBLISH"); found {
+				if n.Publish, err = url.Parse(publish); err != nil {
+					return
+				}
+			}
+
+			nodes = append(nodes, n)
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Container < nodes[j].Container
+	})
+
+	return
+}
+
+// selectNetworkNodes returns the nodes matching with one of selectors; the
+// selector, which matches no node is error.
+func selectNetworkNodes(nodes []NetworkNode, selectors []string) (selected []NetworkNode, err error) {
+	m := composer.NewNodeMatcher(selectors)
+	for _, n := range nodes {
+		if m.Match(n.Host, n.Container) {
+			selected = append(selected, n)
+		}
+	}
+
+	if err = m.Err(); err != nil {
+		selected = nil
+	}
+
+	return
+}
@@ -1,31 +1,26 @@
 package cmd
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"net"
-	"net/url"
 	"os"
-	"strings"
 
-	"github.com/docker/docker/api/types"
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 var (
 	nodeInfoCmd *cobra.Command
 )
 
-func parseNodeInoFlags() {
+func parseNodeInoFlags() error {
 	{
 		var err error
 		var logLevel logging.Lvl
 		if logLevel, err = logging.LvlFromString(flagLogLevel); err != nil {
-			fmt.Printf("invalid `log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `log-level`: %v", err)
 		}
 
 		var formatter logging.Format
@@ -43,10 +38,110 @@ func parseNodeInoFlags() {
 	{
 		var err error
 		if _, err = logging.LvlFromString(flagSebakLogLevel); err != nil {
-			fmt.Printf("invalid `sebak-log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `sebak-log-level`: %v", err)
 		}
 	}
+
+	switch flagOutput {
+	case "table", "json":
+	default:
+		return PrintFlagsError(nodeInfoCmd, "--output", fmt.Errorf("unknown output format, '%s'", flagOutput))
+	}
+
+	if flagWatch && flagWatchInterval <= 0 {
+		return PrintFlagsError(nodeInfoCmd, "--interval", fmt.Errorf("must be greater than 0"))
+	}
+
+	return nil
+}
+
+// findNodeTargets returns the running nodes of the hosts; with
+// `--skip-unreachable`, the hosts failing to list the containers are skipped.
+func findNodeTargets(hosts []*DockerHost) (targets []NodeTarget, err error) {
+	if targets, err = composer.Targets(rootContext, hosts, composerOptions()); err == nil {
+		return
+	}
+
+	if !flagSkipUnreachable {
+		return
+	}
+	log.Error("docker hosts are unreachable; skipped", "error", err)
+
+	return targets, nil
+}
+
+func getNodeStatuses(targets []NodeTarget) []NodeStatus {
+	return composer.NodeStatuses(rootContext, targets, composer.StatusOptions{
+		Options:     composerOptions(),
+		HTTPTimeout: flagHTTPTimeout,
+	})
+}
+
+// majorityBlockKey returns the most common block height and hash among the
+// responding nodes.
+func majorityBlockKey(statuses []NodeStatus) (key string) {
+	counts := map[string]int{}
+	var max int
+	for _, s := range statuses {
+		if s.Error != nil {
+			continue
+		}
+
+		k := s.BlockKey()
+		counts[k]++
+		if counts[k] > max {
+			max = counts[k]
+			key = k
+		}
+	}
+
+	return
+}
+
+func printNodeStatuses(statuses []NodeStatus) {
+	majority := majorityBlockKey(statuses)
+
+	header := []string{
+		"host", "alias", "address", "endpoint", "state",
+		"height", "hash", "total-txs", "version", "validators",
+	}
+
+	var rows [][]string
+	var highlighted []bool
+	for _, s := range statuses {
+		if s.Error != nil {
+			rows = append(rows, []string{
+				s.Target.Host.Name, s.Target.Container, "-", s.Target.Endpoint, "UNREACHABLE",
+				"-", "-", "-", "-", "-",
+			})
+			highlighted = append(highlighted, true)
+			continue
+		}
+
+		version := s.Info.Node.Version.Version
+		if len(version) < 1 {
+			version = s.Info.Node.Version.GitCommit
+		}
+		if len(version) < 1 {
+			version = "-"
+		}
+
+		rows = append(rows, []string{
+			s.Target.Host.Name,
+			s.Info.Node.Alias,
+			s.Info.Node.Address,
+			s.Target.Endpoint,
+			s.Info.Node.State,
+			fmt.Sprintf("%d", s.Info.Block.Height),
+			s.Info.Block.Hash,
+			fmt.Sprintf("%d", s.Info.Block.TotalTxs),
+			version,
+			fmt.Sprintf("%d", len(s.Info.Node.Validators)),
+		})
+		highlighted = append(highlighted, s.BlockKey() != majority)
+	}
+
+	printTable(os.Stdout, header, rows, highlighted, isatty.IsTerminal(os.Stdout.Fd()))
 }
 
 func init() {
@@ -54,77 +149,73 @@ func init() {
 		Use:   "node <config>",
 		Short: "running sebak nodes",
 		Args:  cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, args []string) {
+		RunE: func(c *cobra.Command, args []string) error {
 			var err error
 			if config, err = parseConfig(args[0]); err != nil {
-				PrintFlagsError(runCmd, "<config>", err)
+				return PrintFlagsError(nodeInfoCmd, "<config>", err)
 			}
 
-			parseNodeInoFlags()
+			if err = parseNodeInoFlags(); err != nil {
+				return err
+			}
+			var hosts []*DockerHost
+			if hosts, err = connectNodeHosts(flagNodes); err != nil {
+				return err
+			}
 
 			// get container info
-			var endpoints []string
-			var containers []types.Container
-			for _, dh := range config.DockerHosts {
-				cl, err := findContainersByPrefix(dh.Client(), "scn.")
-				if err != nil {
-					log.Error("failed to get containers", "error", err)
-					os.Exit(1)
-				}
-				containers = append(containers, cl...)
-
-				for _, c := range cl {
-					if c.State == "exited" {
-						continue
-					}
-
-					j, err := dh.Client().ContainerInspect(context.Background(), c.ID)
-					if err != nil {
-						log.Error("failed to inspect containers", "error", err)
-						os.Exit(1)
-					}
-
-					for _, e := range j.Config.Env {
-						if !strings.HasPrefix(e, "SEBAK_PUBLISH=") {
-							continue
-						}
-
-						du, _ := url.Parse(dh.Host)
-						dhost, _, _ := net.SplitHostPort(du.Host)
-						u, _ := url.Parse(strings.Replace(e, "SEBAK_PUBLISH=", "", 1))
-						_, port, _ := net.SplitHostPort(u.Host)
+			var targets []NodeTarget
+			if targets, err = findNodeTargets(hosts); err != nil {
+				log.Error("failed to get containers", "error", err)
+				return reported(exitCodeError, err)
+			}
+			if targets, err = selectNodeTargets(targets, flagNodes); err != nil {
+				return PrintFlagsError(nodeInfoCmd, "--node", err)
+			}
 
-						u.Host = fmt.Sprintf("%s:%s", dhost, port)
+			if len(targets) < 1 {
+				return PrintError(nodeInfoCmd, fmt.Errorf("containers not found"))
+			}
 
-						endpoints = append(endpoints, u.String())
-					}
-				}
+			if flagWatch {
+				watchNodes(targets, flagWatchInterval)
+				return nil
 			}
 
-			if len(endpoints) < 1 {
-				PrintError(nodeInfoCmd, fmt.Errorf("containers not found"))
+			statuses := getNodeStatuses(targets)
+
+			if flagOutput == "table" {
+				printNodeStatuses(statuses)
+				printState()
+				return nil
 			}
 
-			// get publish endpoint
-			for _, endpoint := range endpoints {
-				b, err := HTTPGet(endpoint)
-				if err != nil {
-					log.Error("failed to get response", "endpoint", endpoint)
+			for _, s := range statuses {
+				if s.Error != nil {
+					log.Error("failed to get response", "endpoint", s.Target.Endpoint, "error", s.Error)
+					continue
 				}
+
 				if flagVerbose {
-					fmt.Println(string(b))
+					fmt.Println(string(s.Body))
 				} else {
 					var m map[string]interface{}
-					json.Unmarshal(b, &m)
-					b, _ = json.Marshal(m)
+					json.Unmarshal(s.Body, &m)
+					b, _ := json.Marshal(m)
 					fmt.Println(string(b))
 				}
 			}
+
+			return nil
 		},
 	}
 
 	nodeInfoCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
 	nodeInfoCmd.Flags().BoolVar(&flagVerbose, "verbose", flagVerbose, "verbose")
+	nodeInfoCmd.Flags().StringVar(&flagOutput, "output", flagOutput, "output format, {table, json}")
+	nodeInfoCmd.Flags().BoolVar(&flagWatch, "watch", flagWatch, "poll the nodes and redraw the table continuously")
+	nodeInfoCmd.Flags().DurationVar(&flagWatchInterval, "interval", flagWatchInterval, "polling interval for --watch")
+	nodeInfoCmd.Flags().Var(&flagNodes, "node", "host name, container name, node alias or node address to show; can be given multiple times")
 
 	rootCmd.AddCommand(nodeInfoCmd)
 }
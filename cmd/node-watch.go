@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	isatty "github.com/mattn/go-isatty"
+)
+
+// nodeWatchState keeps the block height history of node for `node --watch`.
+type nodeWatchState struct {
+	startHeight     uint64
+	startTime       time.Time
+	height          uint64
+	delta           uint64
+	lastBlockTime   time.Time
+	lastRespondTime time.Time
+	responded       bool
+}
+
+func (w *nodeWatchState) update(s NodeStatus, now time.Time) {
+	if s.Error != nil {
+		return
+	}
+
+	height := s.Info.Block.Height
+	if !w.responded {
+		w.startHeight = height
+		w.startTime = now
+		w.height = height
+		w.lastBlockTime = now
+		w.responded = true
+	}
+
+	w.delta = 0
+	if height > w.height {
+		w.delta = height - w.height
+		w.lastBlockTime = now
+	}
+	w.height = height
+	w.lastRespondTime = now
+}
+
+func (w *nodeWatchState) blocksPerMinute(now time.Time) float64 {
+	elapsed := now.Sub(w.startTime).Minutes()
+	if !w.responded || elapsed <= 0 || w.height < w.startHeight {
+		return 0
+	}
+
+	return float64(w.height-w.startHeight) / elapsed
+}
+
+func printNodeWatch(statuses []NodeStatus, states []*nodeWatchState, now time.Time, colored bool) []byte {
+	majority := majorityBlockKey(statuses)
+
+	header := []string{
+		"host", "alias", "endpoint", "state", "height", "delta", "blocks/min", "last-block", "response",
+	}
+
+	var rows [][]string
+	var highlighted []bool
+	for i, s := range statuses {
+		w := states[i]
+
+		var response string
+		if s.Error == nil {
+			response = "ok"
+		} else if !w.responded {
+			response = "NOT RESPONDING"
+		} else {
+			response = fmt.Sprintf("NOT RESPONDING for %s", now.Sub(w.lastRespondTime).Truncate(time.Second))
+		}
+
+		if !w.responded {
+			rows = append(rows, []string{
+				s.Target.Host.Name, s.Target.Container, s.Target.Endpoint, "-", "-", "-", "-", "-", response,
+			})
+			highlighted = append(highlighted, true)
+			continue
+		}
+
+		state := s.Info.Node.State
+		if s.Error != nil {
+			state = "-"
+		}
+
+		rows = append(rows, []string{
+			s.Target.Host.Name,
+			s.Name(),
+			s.Target.Endpoint,
+			state,
+			fmt.Sprintf("%d", w.height),
+			fmt.Sprintf("+%d", w.delta),
+			fmt.Sprintf("%.2f", w.blocksPerMinute(now)),
+			fmt.Sprintf("%s ago", now.Sub(w.lastBlockTime).Truncate(time.Second)),
+			response,
+		})
+		highlighted = append(highlighted, s.Error != nil || s.BlockKey() != majority)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n", now.Format(time.RFC3339))
+	printTable(&b, header, rows, highlighted, colored)
+
+	return b.Bytes()
+}
+
+// watchNodes polls the nodes every interval and redraws the status table.
+func watchNodes(targets []NodeTarget, interval time.Duration) {
+	terminal := isatty.IsTerminal(os.Stdout.Fd())
+
+	states := make([]*nodeWatchState, len(targets))
+	for i := range targets {
+		states[i] = &nodeWatchState{}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		statuses := getNodeStatuses(targets)
+		for i, s := range statuses {
+			states[i].update(s, now)
+		}
+
+		b := printNodeWatch(statuses, states, now, terminal)
+		if terminal {
+			// move the cursor to the top and clear the screen
+			fmt.Fprint(os.Stdout, "\x1b[H\x1b[2J")
+		}
+		os.Stdout.Write(b)
+
+		select {
+		case <-ticker.C:
+		case <-rootContext.Done():
+			return
+		}
+	}
+}
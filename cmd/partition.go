@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const partitionChain string = "SCN-PARTITION"
+
+var (
+	partitionCmd *cobra.Command
+
+	healPartitionScript = strings.Join([]string{
+		fmt.Sprintf("iptables -D OUTPUT -j %s 2>/dev/null", partitionChain),
+		fmt.Sprintf("iptables -F %s 2>/dev/null", partitionChain),
+		fmt.Sprintf("iptables -X %s 2>/dev/null", partitionChain),
+		"true",
+	}, "; ")
+)
+
+// partitionUnit is the network namespace where the iptables rules are
+// applied; it is the node container, or the host in host network mode.
+type partitionUnit struct {
+	Name        string
+	Host        *DockerHost
+	NetworkMode string
+	Blocked     []*url.URL
+}
+
+// Script drops the outgoing packets to the blocked endpoints; the existing
+// rules are flushed first.
+func (u partitionUnit) Script() string {
+	lines := []string{
+		"set -e",
+		fmt.Sprintf("iptables -N %s 2>/dev/null || iptables -F %s", partitionChain, partitionChain),
+		fmt.Sprintf("iptables -C OUTPUT -j %s 2>/dev/null || iptables -I OUTPUT -j %s", partitionChain, partitionChain),
+	}
+
+	for _, b := range u.Blocked {
+		ip, port, _ := net.SplitHostPort(b.Host)
+		lines = append(lines, fmt.Sprintf("iptables -A %s -p tcp -d %s --dport %s -j DROP", partitionChain, ip, port))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func parsePartitionGroups(s string, nodes []NetworkNode) (groups [][]NetworkNode, err error) {
+	seen := map[string]int{}
+	for i, g := range strings.Split(s, "|") {
+		var selectors []string
+		for _, n := range strings.Split(g, ",") {
+			if n = strings.TrimSpace(n); len(n) > 0 {
+				selectors = append(selectors, n)
+			}
+		}
+		if len(selectors) < 1 {
+			err = fmt.Errorf("empty group found")
+			return
+		}
+
+		var selected []NetworkNode
+		if selected, err = selectNetworkNodes(nodes, selectors); err != nil {
+			return
+		}
+
+		for _, n := range selected {
+			if j, found := seen[n.Container]; found && j != i {
+				err = fmt.Errorf("node, '%s' is in multiple groups", n.Container)
+				return
+			}
+			seen[n.Container] = i
+		}
+
+		groups = append(groups, selected)
+	}
+
+	if len(groups) < 2 {
+		err = fmt.Errorf("at least 2 groups are needed")
+	}
+
+	return
+}
+
+// planPartition makes the units to block the traffic between groups. The
+// nodes not in any group can talk with every node.
+func planPartition(nodes []NetworkNode, groups [][]NetworkNode) (units []partitionUnit, err error) {
+	groupOf := map[string]int{}
+	for i, g := range groups {
+		for _, n := range g {
+			groupOf[n.Container] = i
+		}
+	}
+
+	blocked := func(group int) (endpoints []*url.URL) {
+		for i, g := range groups {
+			if i == group {
+				continue
+			}
+			for _, n := range g {
+				if n.Publish != nil {
+					endpoints = append(endpoints, n.Publish)
+				}
+			}
+		}
+		return
+	}
+
+	if !config.Network.IsHost() {
+		for _, n := range nodes {
+			u := partitionUnit{Name: n.Container, Host: n.Host, NetworkMode: n.NetworkMode()}
+			if g, found := groupOf[n.Container]; found {
+				u.Blocked = blocked(g)
+			}
+			units = append(units, u)
+		}
+
+		return
+	}
+
+	// in host network mode, the nodes of same host share the network, so
+	// they must be in the same group.
+	hostGroup := map[*DockerHost]int{}
+	for _, n := range nodes {
+		g, found := groupOf[n.Container]
+		if !found {
+			continue
+		}
+		if hg, found := hostGroup[n.Host]; found && hg != g {
+			err = fmt.Errorf(
+				"in host network mode, the nodes of the same host, '%s' can not be in different groups",
+				n.Host.Name,
+			)
+			return
+		}
+		hostGroup[n.Host] = g
+	}
+
+	for _, dh := range config.DockerHosts {
+		u := partitionUnit{Name: dh.Name, Host: dh, NetworkMode: "host"}
+		if g, found := hostGroup[dh]; found {
+			u.Blocked = blocked(g)
+		}
+		units = append(units, u)
+	}
+
+	return
+}
+
+// runPartitionUnits runs the script of each unit in the helper containers and
+// returns the names of the units, which succeeded.
+func runPartitionUnits(units []partitionUnit, script func(partitionUnit) string) (applied []string, failed bool) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(units))
+	for _, u := range units {
+		go func(u partitionUnit) {
+			defer wg.Done()
+
+			_, err := runHelper(u.Host, u.Name, u.NetworkMode, script(u))
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err != nil {
+				failed = true
+				log.Error("failed to run iptables", "target", u.Name, "error", err)
+				return
+			}
+			applied = append(applied, u.Name)
+			log.Debug("iptables applied", "target", u.Name, "blocked", len(u.Blocked))
+		}(u)
+	}
+	wg.Wait()
+
+	sort.Strings(applied)
+
+	return
+}
+
+// applyPartition blocks the traffic between the groups and saves the
+// partition state with the units, which succeeded; `failed` is true if some
+// units are failed. If every unit is failed, the state is not changed.
+func applyPartition(s string) (partition *PartitionState, failed bool, err error) {
+	var nodes []NetworkNode
+	if nodes, err = findNetworkNodes(config.DockerHosts); err != nil {
+		return
+	}
+
+	var groups [][]NetworkNode
+	if groups, err = parsePartitionGroups(s, nodes); err != nil {
+		return
+	}
+
+	var units []partitionUnit
+	if units, err = planPartition(nodes, groups); err != nil {
+		return
+	}
+
+	var applied []string
+	if applied, failed = runPartitionUnits(units, partitionUnit.Script); len(applied) < 1 {
+		err = fmt.Errorf("failed to apply iptables to any node")
+		return
+	}
+
+	var state *State
+	if state, err = loadState(); err != nil {
+		return
+	}
+
+	partition = &PartitionState{Created: time.Now(), Applied: applied}
+	for _, g := range groups {
+		var names []string
+		for _, n := range g {
+			names = append(names, n.Container)
+		}
+		partition.Groups = append(partition.Groups, names)
+	}
+	state.Partition = partition
+	err = state.Save()
+
+	return
+}
+
+func init() {
+	partitionCmd = &cobra.Command{
+		Use:   "partition <config>",
+		Short: "block the traffic between the groups of sebak nodes",
+		Long: `block the traffic between the groups of sebak nodes
+
+The groups are separated by '|' and the nodes of group are separated by ','; the
+node can be host name, container name, node alias or node address. The nodes not
+in any group can talk with every node.
+
+  $ partition config.toml --groups 'seoul0|scn.GDO7,GD6D.QDZT'`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(partitionCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			ch := Ticker()
+			partition, failed, err := applyPartition(flagPartitionGroups)
+			ch <- true
+			if err != nil {
+				log.Error("failed to partition", "groups", flagPartitionGroups, "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			fmt.Printf("partition: %s\n", partition)
+			if failed {
+				return reported(exitCodeError, fmt.Errorf("failed to partition some nodes"))
+			}
+
+			return nil
+		},
+	}
+
+	partitionCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	partitionCmd.Flags().StringVar(&flagPartitionGroups, "groups", flagPartitionGroups, "groups of nodes, like 'A,B|C,D'")
+
+	rootCmd.AddCommand(partitionCmd)
+}
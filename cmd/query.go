@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	isatty "github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+var (
+	accountCmd *cobra.Command
+	txCmd      *cobra.Command
+	blockCmd   *cobra.Command
+)
+
+// QueryResult is the response of the API of one node.
+type QueryResult struct {
+	Target NodeTarget             `json:"-"`
+	Node   string                 `json:"node"`
+	Value  map[string]interface{} `json:"value,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// Key returns the canonical json of the value without links, which is used to
+// compare the responses of nodes.
+func (r QueryResult) Key() string {
+	if len(r.Error) > 0 {
+		return ""
+	}
+
+	b, _ := json.Marshal(r.Value)
+	return string(b)
+}
+
+// selectNodeTargets returns the node targets matching with the selectors; see
+// `composer.MatchNode`. The selector, which matches no target is error.
+func selectNodeTargets(targets []NodeTarget, selectors []string) (selected []NodeTarget, err error) {
+	m := composer.NewNodeMatcher(selectors)
+	for _, t := range targets {
+		if m.Match(t.Host, t.Container) {
+			selected = append(selected, t)
+		}
+	}
+
+	if err = m.Err(); err != nil {
+		selected = nil
+	}
+
+	return
+}
+
+func queryNodes(targets []NodeTarget, p string) []QueryResult {
+	results := make([]QueryResult, len(targets))
+
+	var wg sync.WaitGroup
+	wg.Add(len(targets))
+	for i, t := range targets {
+		go func(i int, t NodeTarget) {
+			defer wg.Done()
+
+			r := QueryResult{Target: t, Node: t.Container}
+			b, err := HTTPGet(strings.TrimRight(t.Endpoint, "/") + p)
+			if err == nil {
+				err = json.Unmarshal(b, &r.Value)
+			}
+			if err != nil {
+				r.Error = err.Error()
+			}
+			delete(r.Value, "_links")
+
+			results[i] = r
+		}(i, t)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// majorityQueryKey returns the most common response among the responding
+// nodes.
+func majorityQueryKey(results []QueryResult) (key string) {
+	counts := map[string]int{}
+	var max int
+	for _, r := range results {
+		if len(r.Error) > 0 {
+			continue
+		}
+
+		k := r.Key()
+		counts[k]++
+		if counts[k] > max {
+			max = counts[k]
+			key = k
+		}
+	}
+
+	return
+}
+
+func printQueryValue(value map[string]interface{}) {
+	var keys []string
+	for k := range value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var rows [][]string
+	var highlighted []bool
+	for _, k := range keys {
+		var s string
+		switch v := value[k].(type) {
+		case string:
+			s = v
+		case nil:
+			s = "-"
+		case map[string]interface{}, []interface{}:
+			b, _ := json.Marshal(v)
+			s = string(b)
+		default:
+			s = fmt.Sprintf("%v", v)
+		}
+		rows = append(rows, []string{k, s})
+		highlighted = append(highlighted, false)
+	}
+
+	printTable(os.Stdout, []string{"field", "value"}, rows, highlighted, false)
+}
+
+// printQueryResults prints the responses of nodes; the node which returns the
+// different answer from majority is highlighted.
+func printQueryResults(results []QueryResult) {
+	majority := majorityQueryKey(results)
+
+	var rows [][]string
+	var highlighted []bool
+	for _, r := range results {
+		status := "same"
+		switch {
+		case len(r.Error) > 0:
+			status = "ERROR: " + r.Error
+		case r.Key() != majority:
+			status = "DIFFERENT"
+		}
+
+		rows = append(rows, []string{r.Target.Host.Name, r.Node, r.Target.Endpoint, status})
+		highlighted = append(highlighted, status != "same")
+	}
+
+	printTable(
+		os.Stdout,
+		[]string{"host", "node", "endpoint", "answer"},
+		rows,
+		highlighted,
+		isatty.IsTerminal(os.Stdout.Fd()),
+	)
+
+	for _, r := range results {
+		if len(r.Error) < 1 && r.Key() == majority {
+			fmt.Println()
+			printQueryValue(r.Value)
+			break
+		}
+	}
+}
+
+func newQueryCmd(use, short, apiPath string) *cobra.Command {
+	var cmd *cobra.Command
+	cmd = &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(cmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			var hosts []*DockerHost
+			if hosts, err = connectNodeHosts(flagNodes); err != nil {
+				return err
+			}
+
+			switch flagOutput {
+			case "table", "json":
+			default:
+				return PrintFlagsError(cmd, "--output", fmt.Errorf("unknown output format, '%s'", flagOutput))
+			}
+
+			var targets []NodeTarget
+			if targets, err = findNodeTargets(hosts); err != nil {
+				log.Error("failed to get containers", "error", err)
+				return reported(exitCodeError, err)
+			}
+			if targets, err = selectNodeTargets(targets, flagNodes); err != nil {
+				return PrintFlagsError(cmd, "--node", err)
+			}
+			if len(targets) < 1 {
+				return PrintError(cmd, fmt.Errorf("containers not found"))
+			}
+			if !flagAllNodes {
+				targets = targets[:1]
+			}
+
+			results := queryNodes(targets, fmt.Sprintf("%s/%s", apiPath, args[1]))
+
+			var diverged, failed bool
+			majority := majorityQueryKey(results)
+			for _, r := range results {
+				if len(r.Error) > 0 {
+					failed = true
+				} else if r.Key() != majority {
+					diverged = true
+				}
+			}
+
+			if flagOutput == "json" {
+				if flagAllNodes {
+					b, _ := json.MarshalIndent(results, "", "  ")
+					fmt.Println(string(b))
+				} else if !failed {
+					b, _ := json.MarshalIndent(results[0].Value, "", "  ")
+					fmt.Println(string(b))
+				}
+			} else if flagAllNodes {
+				printQueryResults(results)
+			} else if !failed {
+				printQueryValue(results[0].Value)
+			}
+
+			switch {
+			case !flagAllNodes && failed:
+				log.Error("failed to get response", "node", results[0].Node, "error", results[0].Error)
+				return reported(exitCodeError, fmt.Errorf("failed to get response; %s", results[0].Error))
+			case diverged:
+				return reported(exitCodeDiverged, fmt.Errorf("nodes are diverged"))
+			case failed:
+				return reported(exitCodeError, fmt.Errorf("failed to get response from some nodes"))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	cmd.Flags().StringVar(&flagOutput, "output", flagOutput, "output format, {table, json}")
+	cmd.Flags().Var(&flagNodes, "node", "host name, container name, node alias or node address to query; by default, the first node")
+	cmd.Flags().BoolVar(&flagAllNodes, "all-nodes", flagAllNodes, "query every node, or every selected node by --node and compare the answers")
+
+	return cmd
+}
+
+func init() {
+	accountCmd = newQueryCmd("account <config> <address>", "show account from sebak node", apiAccountsPath)
+	txCmd = newQueryCmd("tx <config> <hash>", "show transaction from sebak node", apiTransactionsPath)
+	blockCmd = newQueryCmd("block <config> <height|hash>", "show block from sebak node", apiBlocksPath)
+
+	rootCmd.AddCommand(accountCmd)
+	rootCmd.AddCommand(txCmd)
+	rootCmd.AddCommand(blockCmd)
+}
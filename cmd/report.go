@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+const (
+	testCasePass string = "pass"
+	testCaseFail string = "fail"
+	testCaseSkip string = "skip"
+
+	// reportLogLines is the number of the last log lines of container, which
+	// are captured for the failed test case.
+	reportLogLines int = 50
+)
+
+// TestCase is one check of the verifying commands, like the readiness of node
+// or the step of scenario.
+type TestCase struct {
+	Name      string        `json:"name"`
+	ClassName string        `json:"classname"`
+	Status    string        `json:"status"`
+	Elapsed   time.Duration `json:"elapsed"`
+	Message   string        `json:"message,omitempty"`
+	Output    string        `json:"output,omitempty"`
+}
+
+// TestReport is saved as JUnit XML or JSON by the extension of file.
+type TestReport struct {
+	Name    string        `json:"name"`
+	Started time.Time     `json:"started"`
+	Elapsed time.Duration `json:"elapsed"`
+	Cases   []TestCase    `json:"cases"`
+}
+
+func (r TestReport) count(status string) (n int) {
+	for _, c := range r.Cases {
+		if c.Status == status {
+			n++
+		}
+	}
+
+	return
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func (r TestReport) JUnit() ([]byte, error) {
+	suite := junitTestSuite{
+		Name:      r.Name,
+		Tests:     len(r.Cases),
+		Failures:  r.count(testCaseFail),
+		Skipped:   r.count(testCaseSkip),
+		Time:      junitTime(r.Elapsed),
+		Timestamp: r.Started.Format("2006-01-02T15:04:05"),
+	}
+
+	for _, c := range r.Cases {
+		tc := junitTestCase{ClassName: c.ClassName, Name: c.Name, Time: junitTime(c.Elapsed), SystemOut: c.Output}
+		switch c.Status {
+		case testCaseFail:
+			tc.Failure = &junitFailure{Message: c.Message, Text: c.Message}
+		case testCaseSkip:
+			tc.Skipped = &junitSkipped{Message: c.Message}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	b, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+// checkReportPath checks the extension of report file; '.xml' is JUnit XML
+// and '.json' is JSON.
+func checkReportPath(f string) error {
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".xml", ".json":
+		return nil
+	default:
+		return fmt.Errorf("unknown report format, '%s'; it should be .xml or .json", f)
+	}
+}
+
+func (r TestReport) WriteFile(f string) (err error) {
+	var b []byte
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".xml":
+		b, err = r.JUnit()
+	case ".json":
+		b, err = json.MarshalIndent(r, "", "  ")
+	default:
+		err = checkReportPath(f)
+	}
+	if err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(f, b, 0644)
+}
+
+// writeReport writes the report if `--report` is given.
+func writeReport(r TestReport) error {
+	if len(flagReport) < 1 {
+		return nil
+	}
+
+	if err := r.WriteFile(flagReport); err != nil {
+		return err
+	}
+	log.Debug("report saved", "report", flagReport)
+
+	return nil
+}
+
+// nodeLogTail returns the last logs of the node container for the failed test
+// case.
+func nodeLogTail(t NodeTarget) string {
+	c, err := composer.FindContainer(rootContext, t.Host, t.Container, composerOptions())
+	if err != nil || len(c.ID) < 1 {
+		return ""
+	}
+
+	tail, err := getContainerLogTail(t.Host.Client(), c.ID, reportLogLines)
+	if err != nil {
+		return fmt.Sprintf("failed to get logs: %v", err)
+	}
+
+	return tail
+}
+
+// allNodeLogTails returns the last logs of all the node containers.
+func allNodeLogTails() string {
+	var out []string
+	for _, dh := range config.DockerHosts {
+		cl, err := composer.Containers(rootContext, dh, composerOptions())
+		if err != nil {
+			continue
+		}
+		for _, c := range cl {
+			tail, err := getContainerLogTail(dh.Client(), c.ID, reportLogLines)
+			if err != nil {
+				continue
+			}
+			out = append(out, fmt.Sprintf("= %s =\n%s", GetContainerName(c.Names), tail))
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
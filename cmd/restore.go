@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+// restoredMarkerFile is created in the restored node container; the
+// entrypoint does not remove the storage by `SEBAK_INITIALIZE=1`, if it
+// exists. It is not in the storage volume, so the new container of `run`
+// still initializes the storage.
+const restoredMarkerFile string = "/sebak-network-composer.restored"
+
+var (
+	restoreCmd *cobra.Command
+)
+
+// storageKey returns the key of the storage path of node container; the
+// nodes of the same host, whose storage is in the same source of volume have
+// the same key.
+func storageKey(dh *DockerHost, container, p string) string {
+	for _, v := range dh.Volume {
+		target := strings.TrimRight(v.Target, "/")
+		if p == target || strings.HasPrefix(p, target+"/") {
+			return fmt.Sprintf("%s:%s", dh.Host, path.Join(v.Source, strings.TrimPrefix(p, target)))
+		}
+	}
+
+	return fmt.Sprintf("%s:%s:%s", dh.Host, container, p)
+}
+
+// groupSnapshotNodes groups the snapshot nodes by the storage of host, so the
+// shared storage is restored once.
+func groupSnapshotNodes(nodes []*SnapshotNode) (groups map[string][][]*SnapshotNode, err error) {
+	groups = map[string][][]*SnapshotNode{}
+
+	index := map[string]int{}
+	for _, sn := range nodes {
+		dh, found := config.GetDockerHost(sn.Host)
+		if !found {
+			err = fmt.Errorf("unknown host found: %s", sn.Host)
+			return
+		}
+
+		key := storageKey(dh, sn.Container, sn.Path)
+		if i, found := index[key]; found {
+			groups[sn.Host][i] = append(groups[sn.Host][i], sn)
+			continue
+		}
+		index[key] = len(groups[sn.Host])
+		groups[sn.Host] = append(groups[sn.Host], []*SnapshotNode{sn})
+	}
+
+	return
+}
+
+// restoreSnapshotNodes stops the node containers, which share the storage,
+// replaces the storage with the archive of the first node and starts them
+// again. Once the containers are stopped, the restore is not interrupted by
+// the root context, so the canceled restore does not leave the nodes stopped
+// with the half-restored storage.
+func restoreSnapshotNodes(directory string, sns []*SnapshotNode) (err error) {
+	dh, found := config.GetDockerHost(sns[0].Host)
+	if !found {
+		err = fmt.Errorf("unknown host found: %s", sns[0].Host)
+		return
+	}
+
+	var ids []string
+	for _, sn := range sns {
+		var c types.Container
+		if c, err = composer.FindContainer(rootContext, dh, sn.Container, composerOptions()); err != nil {
+			return
+		} else if len(c.ID) < 1 {
+			err = fmt.Errorf("container not found: %s", sn.Container)
+			return
+		}
+		ids = append(ids, c.ID)
+	}
+
+	var imageID string
+	if imageID, err = prepareCleanContainerPath(dh); err != nil {
+		return
+	}
+
+	var f *os.File
+	if f, err = os.Open(filepath.Join(directory, sns[0].File)); err != nil {
+		return
+	}
+	defer f.Close()
+
+	if canceled() {
+		return rootContext.Err()
+	}
+
+	for i, id := range ids {
+		if err = stopContainerForRestore(dh, id); err != nil {
+			// the storage is not touched yet, so the stopped nodes are
+			// started again.
+			for _, stopped := range ids[:i] {
+				startContainerForRestore(dh, stopped)
+			}
+			return
+		}
+	}
+
+	// the storage is cleaned and copied without timeout; the second signal
+	// exits immediately.
+	ctx := context.Background()
+	if err = cleanContainerPath(ctx, dh, imageID, ids[0], sns[0].Path); err != nil {
+		return
+	}
+
+	// the archive from `CopyFromContainer` starts with the base name of the
+	// path, so it is extracted into the parent directory.
+	err = dh.Client().CopyToContainer(
+		ctx,
+		ids[0],
+		path.Dir(sns[0].Path),
+		f,
+		types.CopyToContainerOptions{AllowOverwriteDirWithFile: false},
+	)
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		if err = writeContainerFile(ctx, dh.Client(), id, restoredMarkerFile, []byte("1\n")); err != nil {
+			return
+		}
+		if err = startContainerForRestore(dh, id); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func stopContainerForRestore(dh *DockerHost, id string) error {
+	ctx, cancel := cleanupContext()
+	defer cancel()
+
+	return dh.Client().ContainerStop(ctx, id, nil)
+}
+
+func startContainerForRestore(dh *DockerHost, id string) error {
+	ctx, cancel := cleanupContext()
+	defer cancel()
+
+	return dh.Client().ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+func init() {
+	restoreCmd = &cobra.Command{
+		Use:   "restore <config> <name>",
+		Short: "restore the storage of sebak containers from snapshot",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(restoreCmd, "<config>", err)
+			}
+
+			if err = parseSnapshotFlags(args[1]); err != nil {
+				return err
+			}
+
+			directory := filepath.Join(flagSnapshotPath, args[1])
+
+			var snapshot *Snapshot
+			if snapshot, err = loadSnapshot(directory); err != nil {
+				return PrintFlagsError(restoreCmd, "<name>", err)
+			}
+
+			var hosts []*DockerHost
+			for _, dh := range config.DockerHosts {
+				for _, sn := range snapshot.Nodes {
+					if sn.Host == dh.Host {
+						hosts = append(hosts, dh)
+						break
+					}
+				}
+			}
+			if err = connectHosts(hosts); err != nil {
+				return err
+			}
+
+			var byHost map[string][][]*SnapshotNode
+			if byHost, err = groupSnapshotNodes(snapshot.Nodes); err != nil {
+				return PrintFlagsError(restoreCmd, "<name>", err)
+			}
+
+			var failed bool
+			var lock sync.Mutex
+			var wg sync.WaitGroup
+
+			// the nodes, which share the storage are restored together, and
+			// the storages of the same host are restored one by one.
+			wg.Add(len(byHost))
+			for _, groups := range byHost {
+				go func(groups [][]*SnapshotNode) {
+					defer wg.Done()
+
+					for _, sns := range groups {
+						if err := restoreSnapshotNodes(directory, sns); err != nil {
+							lock.Lock()
+							failed = true
+							lock.Unlock()
+							log.Error("failed to restore", "container", sns[0].Container, "nodes", len(sns), "error", err)
+							continue
+						}
+						for _, sn := range sns {
+							log.Debug("restored", "container", sn.Container, "height", sns[0].Height, "hash", sns[0].Hash)
+						}
+					}
+				}(groups)
+			}
+
+			ch := Ticker()
+			wg.Wait()
+			ch <- true
+
+			if failed {
+				log.Error("failed to restore snapshot", "snapshot", directory)
+				return reported(exitCodeError, fmt.Errorf("failed to restore snapshot, '%s'", directory))
+			}
+
+			log.Debug("done", "snapshot", directory)
+
+			return nil
+		},
+	}
+
+	restoreCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	restoreCmd.Flags().StringVar(&flagSnapshotPath, "snapshot-directory", flagSnapshotPath, "directory to store snapshots")
+
+	rootCmd.AddCommand(restoreCmd)
+}
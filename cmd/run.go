@@ -1,33 +1,27 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"regexp"
-	"sync"
 	"time"
 
-	"boscoin.io/sebak/lib/common"
 	"boscoin.io/sebak/lib/node"
-	"github.com/docker/docker/api/types"
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 var (
 	runCmd *cobra.Command
 )
 
-func parseRunFlags() {
+func parseRunFlags() error {
 	{
 		var err error
 		var logLevel logging.Lvl
 		if logLevel, err = logging.LvlFromString(flagLogLevel); err != nil {
-			fmt.Printf("invalid `log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `log-level`: %v", err)
 		}
 
 		var formatter logging.Format
@@ -45,11 +39,22 @@ func parseRunFlags() {
 	{
 		var err error
 		if _, err = logging.LvlFromString(flagSebakLogLevel); err != nil {
-			fmt.Printf("invalid `sebak-log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `sebak-log-level`: %v", err)
 		}
 	}
 
+	if len(flagReport) > 0 {
+		if err := checkReportPath(flagReport); err != nil {
+			return PrintFlagsError(runCmd, "--report", err)
+		}
+	}
+
+	if flagSkipUnreachable {
+		// the nodes of all hosts are composed as one network, so the nodes
+		// of skipped hosts would be missing from the network.
+		return PrintFlagsError(runCmd, "--skip-unreachable", fmt.Errorf("can not be used with run"))
+	}
+
 	log.Debug("Starting to compose sebak network")
 	log.Debug(fmt.Sprintf(
 		`
@@ -59,59 +64,47 @@ sebak log level: %s
 		flagLogLevel,
 		flagSebakLogLevel,
 	))
+
+	return nil
 }
 
-func composeNetwork() map[string]*node.LocalNode {
-	var numberOfNodes int
-	for _, dh := range config.DockerHosts {
-		numberOfNodes += len(dh.Keys)
+// readinessReport returns the test report of readiness; every node is a test
+// case, which fails if the node does not respond to the node info request.
+func readinessReport(started time.Time, elapsed time.Duration) (report TestReport, err error) {
+	report = TestReport{Name: "run", Started: started, Elapsed: time.Since(started)}
+
+	var targets []NodeTarget
+	if targets, err = findNodeTargets(config.DockerHosts); err != nil {
+		return
 	}
 
-	log.Debug("trying to compose network", "number of nodes", numberOfNodes)
+	statuses := map[string]NodeStatus{}
+	for _, s := range getNodeStatuses(targets) {
+		statuses[s.Target.Container] = s
+	}
 
-	nodes := map[string]*node.LocalNode{}
 	for _, dh := range config.DockerHosts {
-		var port int = baseContainerPort
-		for _, kp := range dh.Keys {
-			endpoint, err := common.NewEndpointFromString(fmt.Sprintf(
-				"https://%s:%d",
-				dh.IP,
-				port,
-			))
-			if err != nil {
-				PrintError(runCmd, err)
+		for _, nd := range dh.Nodes {
+			name := makeContainerName(nd)
+			c := TestCase{Name: name, ClassName: "run.readiness", Status: testCasePass, Elapsed: elapsed}
+
+			s, found := statuses[name]
+			switch {
+			case !found:
+				c.Message = "container not found"
+			case s.Error != nil:
+				c.Message = fmt.Sprintf("node not ready; %v", s.Error)
+				c.Output = nodeLogTail(s.Target)
 			}
-
-			nd, err := node.NewLocalNode(kp, endpoint, "")
-			if err != nil {
-				PrintError(runCmd, err)
+			if len(c.Message) > 0 {
+				c.Status = testCaseFail
 			}
-			dh.Nodes = append(dh.Nodes, nd)
-			nodes[kp.Address()] = nd
-
-			log.Debug(
-				"generate node",
-				"address", node.MakeAlias(kp.Address()),
-				"secret-seed", kp.Seed(),
-				"endpoint", endpoint,
-			)
 
-			port += 1
+			report.Cases = append(report.Cases, c)
 		}
 	}
 
-	log.Debug("generate nodes", "nodes", len(nodes))
-
-	for a0, n0 := range nodes {
-		for a1, n1 := range nodes {
-			if a0 == a1 {
-				continue
-			}
-			n0.AddValidators(n1.ConvertToValidator())
-		}
-	}
-
-	return nodes
+	return
 }
 
 func init() {
@@ -119,133 +112,89 @@ func init() {
 		Use:   "run <config>",
 		Short: "sebak composing network",
 		Args:  cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, args []string) {
+		RunE: func(c *cobra.Command, args []string) error {
+			started := time.Now()
+
 			var err error
-			if config, err = parseConfig(args[0]); err != nil {
-				PrintFlagsError(runCmd, "<config>", err)
+			if config, err = parseRunConfig(args[0]); err != nil {
+				return PrintFlagsError(runCmd, "<config>", err)
 			}
 
-			parseRunFlags()
-
-			if flagForceClean {
-				for _, dh := range config.DockerHosts {
-					if err = cleanDocker(dh.Client()); err != nil {
-						PrintError(runCmd, err)
-					}
-				}
+			if err = parseRunFlags(); err != nil {
+				return err
 			}
-
-			var wg sync.WaitGroup
-			{ // check internal ip
-				log.Debug("trying to get internal IP")
-				wg.Add(len(config.DockerHosts))
-				for _, dh := range config.DockerHosts {
-					go func(d *DockerHost) {
-						defer wg.Done()
-
-						var ip string
-						if ip, err = runContainerGettingIP(d.Client()); err != nil {
-							PrintError(runCmd, fmt.Errorf("failed to get internal IP: %v", err))
-						}
-						d.IP = ip
-					}(dh)
-				}
-
-				wg.Wait()
+			if err = connectAllHosts(); err != nil {
+				return err
 			}
 
-			// compose network
-			nodes := composeNetwork()
+			var nodes map[string]*node.LocalNode
+			if nodes, err = composer.Compose(rootContext, config, composerOptions()); err != nil {
+				return err
+			}
 
-			for _, dh := range config.DockerHosts {
-				for _, nd := range dh.Nodes {
-					_, err := runSEBAK(dh, nd)
-					if err != nil {
-						log.Error("failed to run container", "error", err)
-						os.Exit(1)
-					}
-				}
+			readinessStarted := time.Now()
+			deployment, readinessErr := composer.Deploy(rootContext, config, composer.DeployOptions{
+				Options:       composerOptions(),
+				Image:         flagImageName,
+				SebakLogLevel: flagSebakLogLevel,
+				Force:         flagForceClean,
+			})
+			if readinessErr != nil && (canceled() || deployment.Containers == nil) {
+				// failed before the readiness wait
+				return readinessErr
 			}
 
 			// check status
-			infos := map[string]types.Container{}
-			var stop bool
-
-			go func() {
-				for {
-					if stop == true {
-						break
-					}
-					for _, dh := range config.DockerHosts {
-						for _, nd := range dh.Nodes {
-							name := makeContainerName(nd)
-							if info, ok := infos[name]; ok && info.State == "exited" {
-								continue
-							}
-
-							info, err := findContainer(dh.Client(), name)
-							if err != nil {
-								log.Error("something wrong")
-								os.Exit(1)
-							}
-							fmt.Println("<", info.Names[0][1:], info.ID[:4], info.State, info.Status)
-							infos[name] = info
-						}
+			for _, dh := range config.DockerHosts {
+				for _, nd := range dh.Nodes {
+					info, found := deployment.Containers[makeContainerName(nd)]
+					if !found {
+						continue
 					}
-
-					time.Sleep(time.Second)
+					fmt.Println("<", info.Names[0][1:], info.ID[:4], info.State, info.Status)
 				}
-			}()
-
-			select {
-			case <-time.After(time.Second * 5):
-				stop = true
 			}
 
 			for _, dh := range config.DockerHosts {
 				for _, nd := range dh.Nodes {
 					name := makeContainerName(nd)
-					if info, ok := infos[name]; ok && info.State != "exited" {
+					info, found := deployment.Containers[name]
+					if !found || info.State != "exited" {
 						continue
 					}
 
-					var info types.Container
-					info = infos[name]
-
-					resp, err := dh.Client().ContainerLogs(
-						context.Background(),
-						info.ID,
-						types.ContainerLogsOptions{
-							ShowStdout: true,
-							ShowStderr: true,
-						},
-					)
+					tail, err := getContainerLogTail(dh.Client(), info.ID, reportLogLines)
 					if err != nil {
 						log.Error("failed to get container log", "name", name, "error", err)
 						continue
 					}
-					if b, err := ioutil.ReadAll(resp); err != nil {
-						log.Error("failed to get container log", "name", name, "error", err)
-						continue
-					} else {
-						fmt.Printf("= %s =========================================================\n", name)
+					fmt.Printf("= %s =========================================================\n", name)
 
-						re := regexp.MustCompile("\x1B\\[([0-9]{1,3}((;[0-9]{1,3})*)?)?[m|K]")
-						nb := string(re.ReplaceAll(b, []byte("")))
-
-						limit := len(nb) - 1000
-						if limit < 0 {
-							limit = 0
-						}
-
-						fmt.Println("...\n" + nb[limit:])
+					limit := len(tail) - 1000
+					if limit < 0 {
+						limit = 0
 					}
+
+					fmt.Println("...\n" + tail[limit:])
 				}
 			}
 
 			for _, nd := range nodes {
 				log.Debug("launch node", "alias", nd.Alias(), "endpoint", nd.Endpoint())
 			}
+
+			if len(flagReport) > 0 {
+				report, err := readinessReport(started, time.Since(readinessStarted))
+				if err == nil {
+					err = writeReport(report)
+				}
+				if err != nil {
+					log.Error("failed to write report", "report", flagReport, "error", err)
+					return reported(exitCodeError, err)
+				}
+			}
+
+			return readinessErr
 		},
 	}
 
@@ -257,6 +206,7 @@ func init() {
 		"remove the existing sebak containers",
 	)
 	runCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	runCmd.Flags().StringVar(&flagReport, "report", flagReport, "save the readiness report; JUnit XML for .xml and JSON for .json")
 	runCmd.Flags().StringVar(
 		&flagSebakLogLevel,
 		"sebak-log-level",
@@ -0,0 +1,608 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	isatty "github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	scenarioPass string = "pass"
+	scenarioFail string = "fail"
+	scenarioSkip string = "skip"
+
+	defaultScenarioTimeout time.Duration = 5 * time.Minute
+)
+
+var (
+	scenarioCmd *cobra.Command
+)
+
+// Scenario is the list of steps, which are run sequentially.
+type Scenario struct {
+	Name  string         `yaml:"name"`
+	Steps []ScenarioStep `yaml:"steps"`
+}
+
+// ScenarioStep has only one action.
+type ScenarioStep struct {
+	Name       string              `yaml:"name"`
+	Start      []string            `yaml:"start"`
+	Stop       []string            `yaml:"stop"`
+	Kill       []string            `yaml:"kill"`
+	Pause      []string            `yaml:"pause"`
+	Unpause    []string            `yaml:"unpause"`
+	Restart    []string            `yaml:"restart"`
+	Wait       time.Duration       `yaml:"wait"`
+	WaitHeight *ScenarioWaitHeight `yaml:"wait-height"`
+	Load       *ScenarioLoad       `yaml:"load"`
+	Partition  string              `yaml:"partition"`
+	Heal       bool                `yaml:"heal"`
+	Assert     *ScenarioAssert     `yaml:"assert"`
+	Logs       string              `yaml:"logs"`
+}
+
+type ScenarioWaitHeight struct {
+	Height  uint64        `yaml:"height"`
+	Nodes   []string      `yaml:"nodes"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type ScenarioLoad struct {
+	Accounts int           `yaml:"accounts"`
+	Rate     float64       `yaml:"rate"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+// ScenarioAssert compares the field of node info with the value; the field is
+// the dotted path of node info, like 'block.height'. With 'same' operator, all
+// the nodes must have the same value.
+type ScenarioAssert struct {
+	Field string      `yaml:"field"`
+	Op    string      `yaml:"op"`
+	Value interface{} `yaml:"value"`
+	Nodes []string    `yaml:"nodes"`
+}
+
+// Actions returns the names of actions set in the step.
+func (s ScenarioStep) Actions() (actions []string) {
+	for _, a := range []struct {
+		name string
+		set  bool
+	}{
+		{chaosStart, len(s.Start) > 0},
+		{chaosStop, len(s.Stop) > 0},
+		{chaosKill, len(s.Kill) > 0},
+		{chaosPause, len(s.Pause) > 0},
+		{chaosUnpause, len(s.Unpause) > 0},
+		{chaosRestart, len(s.Restart) > 0},
+		{"wait", s.Wait > 0},
+		{"wait-height", s.WaitHeight != nil},
+		{"load", s.Load != nil},
+		{"partition", len(s.Partition) > 0},
+		{"heal", s.Heal},
+		{"assert", s.Assert != nil},
+		{"logs", len(s.Logs) > 0},
+	} {
+		if a.set {
+			actions = append(actions, a.name)
+		}
+	}
+
+	return
+}
+
+func (s ScenarioStep) Action() string {
+	if actions := s.Actions(); len(actions) == 1 {
+		return actions[0]
+	}
+
+	return ""
+}
+
+func (s ScenarioStep) Validate() error {
+	actions := s.Actions()
+	if len(actions) != 1 {
+		return fmt.Errorf("step must have one action, but %d found: %s", len(actions), strings.Join(actions, ", "))
+	}
+
+	if s.Assert != nil {
+		if len(s.Assert.Field) < 1 {
+			return fmt.Errorf("assert: field must be given")
+		}
+		switch s.Assert.Op {
+		case "", "==", "!=", ">", ">=", "<", "<=", "same":
+		default:
+			return fmt.Errorf("assert: unknown operator, '%s'", s.Assert.Op)
+		}
+	}
+
+	return nil
+}
+
+func loadScenario(f string) (scenario Scenario, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(f); err != nil {
+		return
+	}
+
+	if err = yaml.UnmarshalStrict(b, &scenario); err != nil {
+		return
+	}
+
+	if len(scenario.Steps) < 1 {
+		err = fmt.Errorf("no steps found")
+		return
+	}
+
+	for i, s := range scenario.Steps {
+		if err = s.Validate(); err != nil {
+			err = fmt.Errorf("step #%d: %v", i+1, err)
+			return
+		}
+		if len(s.Name) < 1 {
+			scenario.Steps[i].Name = fmt.Sprintf("#%d %s", i+1, s.Action())
+		}
+	}
+
+	return
+}
+
+type ScenarioStepResult struct {
+	Name    string        `json:"name"`
+	Action  string        `json:"action"`
+	Status  string        `json:"status"`
+	Started time.Time     `json:"started"`
+	Elapsed time.Duration `json:"elapsed"`
+	Error   string        `json:"error,omitempty"`
+	Logs    string        `json:"-"`
+}
+
+type ScenarioResult struct {
+	Name    string               `json:"name"`
+	Started time.Time            `json:"started"`
+	Elapsed time.Duration        `json:"elapsed"`
+	Steps   []ScenarioStepResult `json:"steps"`
+}
+
+func (r ScenarioResult) Passed() bool {
+	for _, s := range r.Steps {
+		if s.Status != scenarioPass {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r ScenarioResult) Print() {
+	header := []string{"step", "action", "status", "elapsed", "error"}
+	var rows [][]string
+	var highlighted []bool
+	for _, s := range r.Steps {
+		e := s.Error
+		if len(e) < 1 {
+			e = "-"
+		}
+		rows = append(rows, []string{s.Name, s.Action, s.Status, s.Elapsed.Round(time.Millisecond).String(), e})
+		highlighted = append(highlighted, s.Status == scenarioFail)
+	}
+	printTable(os.Stdout, header, rows, highlighted, isatty.IsTerminal(os.Stdout.Fd()))
+
+	status := "PASS"
+	if !r.Passed() {
+		status = "FAIL"
+	}
+	fmt.Printf("scenario: %s: %s in %s\n", r.Name, status, r.Elapsed.Round(time.Millisecond))
+}
+
+// Report returns the test report; every step is a test case and the last
+// logs of nodes are captured for the failed step.
+func (r ScenarioResult) Report() (report TestReport) {
+	report = TestReport{Name: r.Name, Started: r.Started, Elapsed: r.Elapsed}
+	for _, s := range r.Steps {
+		c := TestCase{Name: s.Name, ClassName: "scenario." + s.Action, Elapsed: s.Elapsed, Message: s.Error}
+		switch s.Status {
+		case scenarioPass:
+			c.Status = testCasePass
+		case scenarioSkip:
+			c.Status = testCaseSkip
+			c.Message = "skipped by the previous failure"
+		default:
+			c.Status = testCaseFail
+			c.Output = s.Logs
+		}
+		report.Cases = append(report.Cases, c)
+	}
+
+	return
+}
+
+// runScenario runs the steps sequentially and stops at the first failed step;
+// the remaining steps are skipped.
+func runScenario(scenario Scenario) (result ScenarioResult) {
+	result.Name = scenario.Name
+	result.Started = time.Now()
+
+	var failed bool
+	for _, step := range scenario.Steps {
+		r := ScenarioStepResult{Name: step.Name, Action: step.Action(), Status: scenarioSkip}
+		if !failed {
+			log.Info("running step", "step", step.Name)
+
+			r.Started = time.Now()
+			err := runScenarioStep(step)
+			r.Elapsed = time.Since(r.Started)
+
+			if err != nil {
+				failed = true
+				r.Status = scenarioFail
+				r.Error = err.Error()
+				log.Error("step failed", "step", step.Name, "error", err)
+				if len(flagReport) > 0 {
+					r.Logs = allNodeLogTails()
+				}
+			} else {
+				r.Status = scenarioPass
+			}
+		}
+		result.Steps = append(result.Steps, r)
+	}
+	result.Elapsed = time.Since(result.Started)
+
+	return
+}
+
+func runScenarioStep(step ScenarioStep) error {
+	switch action := step.Action(); action {
+	case chaosStart:
+		return runScenarioNodeAction(action, step.Start)
+	case chaosStop:
+		return runScenarioNodeAction(action, step.Stop)
+	case chaosKill:
+		return runScenarioNodeAction(action, step.Kill)
+	case chaosPause:
+		return runScenarioNodeAction(action, step.Pause)
+	case chaosUnpause:
+		return runScenarioNodeAction(action, step.Unpause)
+	case chaosRestart:
+		return runScenarioNodeAction(action, step.Restart)
+	case "wait":
+		if !sleep(step.Wait) {
+			return rootContext.Err()
+		}
+		return nil
+	case "wait-height":
+		return waitHeight(*step.WaitHeight)
+	case "load":
+		return runScenarioLoad(*step.Load)
+	case "partition":
+		_, failed, err := applyPartition(step.Partition)
+		if err == nil && failed {
+			err = fmt.Errorf("failed to partition some nodes")
+		}
+		return err
+	case "heal":
+		if healPartition() {
+			return fmt.Errorf("failed to heal")
+		}
+		return nil
+	case "assert":
+		return assertNodeInfo(*step.Assert)
+	case "logs":
+		return collectLogs(step.Logs)
+	default:
+		return fmt.Errorf("unknown action, '%s'", action)
+	}
+}
+
+// findScenarioNodes returns the node containers, including the stopped ones
+// matching with the selectors; see `composer.MatchNode`.
+func findScenarioNodes(selectors []string) (nodes []*chaosNode, err error) {
+	m := composer.NewNodeMatcher(selectors)
+	for _, dh := range config.DockerHosts {
+		cl, e := composer.Containers(rootContext, dh, composerOptions())
+		if e != nil {
+			err = e
+			return
+		}
+
+		for _, c := range cl {
+			name := GetContainerName(c.Names)
+			if m.Match(dh, name) {
+				nodes = append(nodes, &chaosNode{Host: dh, ID: c.ID, Container: name})
+			}
+		}
+	}
+
+	if err = m.Err(); err != nil {
+		nodes = nil
+	}
+
+	return
+}
+
+func runScenarioNodeAction(action string, selectors []string) error {
+	nodes, err := findScenarioNodes(selectors)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if err := runChaosAction(n, action); err != nil {
+			return fmt.Errorf("%s %s: %v", action, n.Container, err)
+		}
+		log.Debug("node action", "action", action, "container", n.Container)
+	}
+
+	return nil
+}
+
+func scenarioTargets(selectors []string) (targets []NodeTarget, err error) {
+	if targets, err = findNodeTargets(config.DockerHosts); err != nil {
+		return
+	}
+	if targets, err = selectNodeTargets(targets, selectors); err != nil {
+		return
+	}
+	if len(targets) < 1 {
+		err = fmt.Errorf("running nodes not found")
+	}
+
+	return
+}
+
+// waitHeight waits until all the nodes reach the block height.
+func waitHeight(w ScenarioWaitHeight) error {
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = defaultScenarioTimeout
+	}
+
+	end := time.Now().Add(timeout)
+	for {
+		var behind []string
+		targets, err := scenarioTargets(w.Nodes)
+		if err == nil {
+			for _, s := range getNodeStatuses(targets) {
+				if s.Error != nil || s.Info.Block.Height < w.Height {
+					behind = append(behind, fmt.Sprintf("%s=%d", s.Name(), s.Info.Block.Height))
+				}
+			}
+			if len(behind) < 1 {
+				return nil
+			}
+		}
+
+		if time.Now().After(end) {
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("height %d not reached in %s: %s", w.Height, timeout, strings.Join(behind, ", "))
+		}
+		if !sleep(time.Second * 2) {
+			return rootContext.Err()
+		}
+	}
+}
+
+func runScenarioLoad(l ScenarioLoad) error {
+	genesis, err := config.GenesisKeypair()
+	if err != nil {
+		return err
+	}
+
+	accounts := l.Accounts
+	if accounts < 1 {
+		accounts = flagLoadAccounts
+	}
+	duration := l.Duration
+	if duration <= 0 {
+		duration = flagLoadDuration
+	}
+
+	report, err := runLoad(genesis, accounts, l.Rate, duration, flagLoadInterval)
+	if err != nil {
+		return err
+	}
+	report.Print()
+
+	if report.Confirmed < 1 {
+		return fmt.Errorf("no transaction confirmed")
+	}
+
+	return nil
+}
+
+// lookupField returns the value of dotted path from the json object.
+func lookupField(m map[string]interface{}, field string) (v interface{}, found bool) {
+	v = m
+	for _, k := range strings.Split(field, ".") {
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, found = o[k]; !found {
+			return
+		}
+	}
+
+	return
+}
+
+func compareValues(a interface{}, op string, b interface{}) bool {
+	as, bs := fmt.Sprintf("%v", a), fmt.Sprintf("%v", b)
+
+	af, aerr := strconv.ParseFloat(as, 64)
+	bf, berr := strconv.ParseFloat(bs, 64)
+	if aerr == nil && berr == nil {
+		switch op {
+		case "", "==":
+			return af == bf
+		case "!=":
+			return af != bf
+		case ">":
+			return af > bf
+		case ">=":
+			return af >= bf
+		case "<":
+			return af < bf
+		case "<=":
+			return af <= bf
+		}
+		return false
+	}
+
+	switch op {
+	case "", "==":
+		return as == bs
+	case "!=":
+		return as != bs
+	case ">":
+		return as > bs
+	case ">=":
+		return as >= bs
+	case "<":
+		return as < bs
+	case "<=":
+		return as <= bs
+	}
+
+	return false
+}
+
+func assertNodeInfo(a ScenarioAssert) error {
+	targets, err := scenarioTargets(a.Nodes)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	var first interface{}
+	var hasFirst bool
+	for _, s := range getNodeStatuses(targets) {
+		if s.Error != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", s.Name(), s.Error))
+			continue
+		}
+
+		var m map[string]interface{}
+		if err := json.Unmarshal(s.Body, &m); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", s.Name(), err))
+			continue
+		}
+
+		v, found := lookupField(m, a.Field)
+		if !found {
+			failures = append(failures, fmt.Sprintf("%s: field not found", s.Name()))
+			continue
+		}
+
+		if a.Op == "same" {
+			if !hasFirst {
+				first, hasFirst = v, true
+			} else if !compareValues(v, "==", first) {
+				failures = append(failures, fmt.Sprintf("%s: %v != %v", s.Name(), v, first))
+			}
+			continue
+		}
+
+		if !compareValues(v, a.Op, a.Value) {
+			failures = append(failures, fmt.Sprintf("%s: %v %s %v is false", s.Name(), v, a.Op, a.Value))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s: %s", a.Field, strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// collectLogs downloads the logs of all the node containers into the
+// directory.
+func collectLogs(directory string) error {
+	_, err := composer.Logs(rootContext, config, directory, composer.LogsOptions{
+		Options: composerOptions(),
+		Since:   flagLogsSince,
+		Tail:    flagLogsTail,
+	})
+
+	return err
+}
+
+func init() {
+	scenarioCmd = &cobra.Command{
+		Use:   "scenario <config> <file.yaml>",
+		Short: "run the steps of scenario against sebak nodes",
+		Long: `run the steps of scenario against sebak nodes
+
+The steps are run sequentially and the scenario stops at the first failed step;
+the pass or fail of every step and the timings are reported.
+
+  name: stop one node
+  steps:
+    - wait-height: {height: 3}
+    - stop: [GDXJ.3YI5]
+    - load: {accounts: 5, rate: 2, duration: 30s}
+    - assert: {field: block.height, op: same}
+    - start: [GDXJ.3YI5]
+    - logs: ./logs`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(scenarioCmd, "<config>", err)
+			}
+
+			var scenario Scenario
+			if scenario, err = loadScenario(args[1]); err != nil {
+				return PrintFlagsError(scenarioCmd, "<file.yaml>", err)
+			}
+			if len(scenario.Name) < 1 {
+				scenario.Name = filepath.Base(args[1])
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			if len(flagReport) > 0 {
+				if err = checkReportPath(flagReport); err != nil {
+					return PrintFlagsError(scenarioCmd, "--report", err)
+				}
+			}
+
+			result := runScenario(scenario)
+			result.Print()
+			if err = writeReport(result.Report()); err != nil {
+				log.Error("failed to write report", "report", flagReport, "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			if !result.Passed() {
+				return reported(exitCodeError, fmt.Errorf("scenario, '%s' failed", scenario.Name))
+			}
+
+			return nil
+		},
+	}
+
+	scenarioCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	scenarioCmd.Flags().StringVar(&flagReport, "report", flagReport, "save the test report; JUnit XML for .xml and JSON for .json")
+
+	rootCmd.AddCommand(scenarioCmd)
+}
@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	logging "github.com/inconshreveable/log15"
+	isatty "github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+const snapshotMetadataFile string = "snapshot.json"
+
+var (
+	snapshotCmd *cobra.Command
+)
+
+type SnapshotNode struct {
+	Host      string `json:"host"`
+	Container string `json:"container"`
+	Address   string `json:"address"`
+	Alias     string `json:"alias"`
+	Endpoint  string `json:"endpoint"`
+	Path      string `json:"path"`
+	File      string `json:"file"`
+	Height    uint64 `json:"height"`
+	Hash      string `json:"hash"`
+}
+
+type Snapshot struct {
+	Name    string          `json:"name"`
+	Created time.Time       `json:"created"`
+	Live    bool            `json:"live"`
+	Nodes   []*SnapshotNode `json:"nodes"`
+}
+
+func loadSnapshot(directory string) (snapshot *Snapshot, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(filepath.Join(directory, snapshotMetadataFile)); err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &snapshot)
+
+	return
+}
+
+func (s *Snapshot) Save(directory string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(directory, snapshotMetadataFile), b, 0644)
+}
+
+// getStoragePath finds the storage path of SEBAK node in the container;
+// `--storage-path` is used first, and `SEBAK_STORAGE` and the volume of host
+// are checked.
+func getStoragePath(dh *DockerHost, j types.ContainerJSON) (string, error) {
+	if len(flagStoragePath) > 0 {
+		return flagStoragePath, nil
+	}
+
+	if s, found := getContainerEnv(j, "SEBAK_STORAGE"); found && strings.HasPrefix(s, "file://") {
+		return strings.TrimPrefix(s, "file://"), nil
+	}
+
+	if len(dh.Volume) == 1 {
+		return dh.Volume[0].Target, nil
+	}
+
+	return "", fmt.Errorf("failed to find storage path; set `--storage-path`")
+}
+
+func archiveContainerPath(dh *DockerHost, containerID, p, output string) (err error) {
+	var reader io.ReadCloser
+	if reader, _, err = dh.Client().CopyFromContainer(rootContext, containerID, p); err != nil {
+		return
+	}
+	defer reader.Close()
+
+	var f *os.File
+	if f, err = os.Create(output); err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, reader)
+
+	return
+}
+
+func parseSnapshotFlags(name string) error {
+	{
+		var err error
+		var logLevel logging.Lvl
+		if logLevel, err = logging.LvlFromString(flagLogLevel); err != nil {
+			return fmt.Errorf("invalid `log-level`: %v", err)
+		}
+
+		var formatter logging.Format
+		if isatty.IsTerminal(os.Stdout.Fd()) {
+			formatter = logging.TerminalFormat()
+		} else {
+			formatter = logging.JsonFormatEx(false, true)
+		}
+		logHandler := logging.StreamHandler(os.Stdout, formatter)
+
+		log = logging.New("module", "main")
+		log.SetHandler(logging.LvlFilterHandler(logLevel, logHandler))
+	}
+
+	if len(name) < 1 || strings.ContainsAny(name, `/\`) {
+		return PrintFlagsError(snapshotCmd, "<name>", fmt.Errorf("invalid snapshot name, '%s'", name))
+	}
+
+	return nil
+}
+
+func init() {
+	snapshotCmd = &cobra.Command{
+		Use:   "snapshot <config> <name>",
+		Short: "snapshot the storage of sebak containers",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(snapshotCmd, "<config>", err)
+			}
+
+			if err = parseSnapshotFlags(args[1]); err != nil {
+				return err
+			}
+			if err = connectAllHosts(); err != nil {
+				return err
+			}
+
+			directory := filepath.Join(flagSnapshotPath, args[1])
+			if _, err = os.Stat(directory); !os.IsNotExist(err) {
+				if !flagForceClean {
+					return PrintFlagsError(snapshotCmd, "<name>", fmt.Errorf("snapshot already exists: '%s'", directory))
+				}
+				if err = os.RemoveAll(directory); err != nil {
+					return PrintError(snapshotCmd, err)
+				}
+			}
+			if err = os.MkdirAll(directory, 0755); err != nil {
+				return PrintError(snapshotCmd, err)
+			}
+
+			snapshot := &Snapshot{
+				Name:    args[1],
+				Created: time.Now(),
+				Live:    flagLive,
+			}
+
+			// collect node info
+			containerIDs := map[*SnapshotNode]string{}
+			var running []*SnapshotNode
+			for _, dh := range config.DockerHosts {
+				cl, err := composer.Containers(rootContext, dh, composerOptions())
+				if err != nil {
+					log.Error("failed to get containers", "error", err)
+					return reported(exitCodeError, err)
+				}
+
+				for _, c := range cl {
+					name := GetContainerName(c.Names)
+					j, err := inspectContainer(dh, c.ID)
+					if err != nil {
+						log.Error("failed to inspect containers", "container", name, "error", err)
+						return reported(exitCodeError, err)
+					}
+
+					p, err := getStoragePath(dh, j)
+					if err != nil {
+						log.Error("failed to get storage path", "container", name, "error", err)
+						return reported(exitCodeError, err)
+					}
+
+					sn := &SnapshotNode{
+						Host:      dh.Host,
+						Container: name,
+						Path:      p,
+						File:      name + ".tar",
+					}
+					if j.State != nil && j.State.Running {
+						running = append(running, sn)
+						if sn.Endpoint, err = getPublishEndpoint(dh, j); err == nil {
+							if info, err := getNodeInfo(sn.Endpoint); err != nil {
+								log.Warn("failed to get node info", "container", name, "error", err)
+							} else {
+								sn.Address = info.Node.Address
+								sn.Alias = info.Node.Alias
+								sn.Height = info.Block.Height
+								sn.Hash = info.Block.Hash
+							}
+						}
+					}
+
+					snapshot.Nodes = append(snapshot.Nodes, sn)
+					containerIDs[sn] = c.ID
+				}
+			}
+
+			if len(snapshot.Nodes) < 1 {
+				return PrintError(snapshotCmd, fmt.Errorf("containers not found"))
+			}
+
+			var wg sync.WaitGroup
+			ch := Ticker()
+
+			if !flagLive {
+				log.Debug("trying to stop containers", "containers", len(running))
+				wg.Add(len(running))
+				for _, sn := range running {
+					go func(sn *SnapshotNode) {
+						defer wg.Done()
+
+						dh, _ := config.GetDockerHost(sn.Host)
+						if err := stopContainer(dh.Client(), containerIDs[sn]); err != nil {
+							log.Error("failed to stop", "container", sn.Container, "error", err)
+						}
+					}(sn)
+				}
+				wg.Wait()
+			}
+
+			var failed bool
+			var lock sync.Mutex
+			wg.Add(len(snapshot.Nodes))
+			for _, sn := range snapshot.Nodes {
+				go func(sn *SnapshotNode) {
+					defer wg.Done()
+
+					dh, _ := config.GetDockerHost(sn.Host)
+					err := archiveContainerPath(dh, containerIDs[sn], sn.Path, filepath.Join(directory, sn.File))
+					if err != nil {
+						lock.Lock()
+						failed = true
+						lock.Unlock()
+						log.Error("failed to archive storage", "container", sn.Container, "error", err)
+					}
+				}(sn)
+			}
+			wg.Wait()
+
+			if !flagLive {
+				// the stopped nodes are started even after the root context is
+				// canceled.
+				log.Debug("trying to start containers", "containers", len(running))
+				wg.Add(len(running))
+				for _, sn := range running {
+					go func(sn *SnapshotNode) {
+						defer wg.Done()
+
+						ctx, cancel := cleanupContext()
+						defer cancel()
+
+						dh, _ := config.GetDockerHost(sn.Host)
+						err := dh.Client().ContainerStart(ctx, containerIDs[sn], types.ContainerStartOptions{})
+						if err != nil {
+							log.Error("failed to start", "container", sn.Container, "error", err)
+						}
+					}(sn)
+				}
+				wg.Wait()
+			}
+
+			ch <- true
+
+			if failed {
+				log.Error("failed to create snapshot", "snapshot", directory)
+				return reported(exitCodeError, fmt.Errorf("failed to create snapshot, '%s'", directory))
+			}
+
+			if err = snapshot.Save(directory); err != nil {
+				return PrintError(snapshotCmd, err)
+			}
+
+			for _, sn := range snapshot.Nodes {
+				fmt.Printf("%s %s %s height=%d hash=%s\n", sn.Container, sn.Alias, sn.Path, sn.Height, sn.Hash)
+			}
+			log.Debug("done", "snapshot", directory)
+
+			return nil
+		},
+	}
+
+	snapshotCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	snapshotCmd.Flags().BoolVar(&flagLive, "live", flagLive, "snapshot without stopping containers")
+	snapshotCmd.Flags().BoolVar(&flagForceClean, "force", flagForceClean, "overwrite the existing snapshot")
+	snapshotCmd.Flags().StringVar(&flagSnapshotPath, "snapshot-directory", flagSnapshotPath, "directory to store snapshots")
+	snapshotCmd.Flags().StringVar(&flagStoragePath, "storage-path", flagStoragePath, "storage path in the containers")
+
+	rootCmd.AddCommand(snapshotCmd)
+}
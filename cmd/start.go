@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -11,19 +10,19 @@ import (
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 var (
 	startCmd *cobra.Command
 )
 
-func parseStartFlags() {
+func parseStartFlags() error {
 	{
 		var err error
 		var logLevel logging.Lvl
 		if logLevel, err = logging.LvlFromString(flagLogLevel); err != nil {
-			fmt.Printf("invalid `log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `log-level`: %v", err)
 		}
 
 		var formatter logging.Format
@@ -41,10 +40,11 @@ func parseStartFlags() {
 	{
 		var err error
 		if _, err = logging.LvlFromString(flagSebakLogLevel); err != nil {
-			fmt.Printf("invalid `sebak-log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `sebak-log-level`: %v", err)
 		}
 	}
+
+	return nil
 }
 
 func init() {
@@ -52,28 +52,42 @@ func init() {
 		Use:   "start <config>",
 		Short: "start sebak containers",
 		Args:  cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, args []string) {
+		RunE: func(c *cobra.Command, args []string) error {
 			var err error
 			if config, err = parseConfig(args[0]); err != nil {
-				PrintFlagsError(runCmd, "<config>", err)
+				return PrintFlagsError(startCmd, "<config>", err)
 			}
 
-			parseStartFlags()
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			var hosts []*DockerHost
+			if hosts, err = connectNodeHosts(flagNodes); err != nil {
+				return err
+			}
 
 			// get container info
 			containers := map[string][]types.Container{}
 			var numContainers int
-			for _, dh := range config.DockerHosts {
-				cl, err := findContainersByPrefix(dh.Client(), "scn.")
+			m := composer.NewNodeMatcher(flagNodes)
+			for _, dh := range hosts {
+				cl, err := composer.Containers(rootContext, dh, composerOptions())
 				if err != nil {
 					log.Error("failed to get containers", "error", err)
-					os.Exit(1)
+					return reported(exitCodeError, err)
 				}
 				if _, found := containers[dh.Host]; !found {
 				}
-				containers[dh.Host] = append(containers[dh.Host], cl...)
+				for _, c := range cl {
+					if m.Match(dh, GetContainerName(c.Names)) {
+						containers[dh.Host] = append(containers[dh.Host], c)
+					}
+				}
 				numContainers++
 			}
+			if err = m.Err(); err != nil {
+				return PrintFlagsError(startCmd, "--node", err)
+			}
 
 			var wg sync.WaitGroup
 
@@ -90,12 +104,12 @@ func init() {
 			for dhHost, cls := range containers {
 				dh, found := config.GetDockerHost(dhHost)
 				if !found {
-					PrintError(startCmd, fmt.Errorf("unknown host key found: %s", dhHost))
+					return PrintError(startCmd, fmt.Errorf("unknown host key found: %s", dhHost))
 				}
 				for _, c := range cls {
 					go func(c types.Container) {
 						defer wg.Done()
-						err := dh.Client().ContainerStart(context.Background(), c.ID, types.ContainerStartOptions{})
+						err := startContainer(dh.Client(), c.ID)
 						if err != nil {
 							log.Error("failed to start", "error", err)
 						}
@@ -107,8 +121,12 @@ func init() {
 			wg.Wait()
 			ch <- true
 			log.Debug("done")
+
+			return nil
 		},
 	}
 
+	startCmd.Flags().Var(&flagNodes, "node", "host name, container name, node alias or node address to start; can be given multiple times")
+
 	rootCmd.AddCommand(startCmd)
 }
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// State is the runtime state of composed network, like network partition,
+// which can not be found from docker. It is saved next to the config file.
+type State struct {
+	Partition *PartitionState       `json:"partition,omitempty"`
+	Netem     map[string]NetemState `json:"netem,omitempty"`
+
+	path string
+}
+
+// PartitionState is the applied network partition; `Applied` is the names of
+// the node containers, or the hosts in host network mode, where the iptables
+// rules are applied.
+type PartitionState struct {
+	Groups  [][]string `json:"groups"`
+	Applied []string   `json:"applied"`
+	Created time.Time  `json:"created"`
+}
+
+func (p PartitionState) String() string {
+	var groups []string
+	for _, g := range p.Groups {
+		groups = append(groups, strings.Join(g, ","))
+	}
+
+	return fmt.Sprintf(
+		"%s (applied to %s, since %s)",
+		strings.Join(groups, " | "),
+		strings.Join(p.Applied, ","),
+		p.Created.Format(time.RFC3339),
+	)
+}
+
+func loadState() (state *State, err error) {
+	state = &State{path: config.Path() + ".state.json"}
+
+	var b []byte
+	if b, err = ioutil.ReadFile(state.path); os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, state)
+
+	return
+}
+
+func (s *State) Save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.path, b, 0644)
+}
+
+// printState prints the current state of network, if exists.
+func printState() {
+	state, err := loadState()
+	if err != nil {
+		log.Error("failed to load state", "error", err)
+		return
+	}
+
+	if state.Partition != nil {
+		fmt.Printf("partition: %s\n", state.Partition)
+	}
+
+	var names []string
+	for name := range state.Netem {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("netem: %s: %s\n", name, state.Netem[name])
+	}
+}
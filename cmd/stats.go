@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+const statsAggregateName string = "<all>"
+
+var (
+	statsCmd *cobra.Command
+
+	statsMetricNames = []string{
+		"cpu-percent",
+		"memory-bytes",
+		"block-read-bytes/s",
+		"block-write-bytes/s",
+		"network-rx-bytes/s",
+		"network-tx-bytes/s",
+	}
+)
+
+// StatsSample is the resource usage of container at the time; the block and
+// network I/O are cumulative.
+type StatsSample struct {
+	Time            time.Time `json:"time"`
+	Host            string    `json:"host"`
+	Container       string    `json:"container"`
+	CPUPercent      float64   `json:"cpu-percent"`
+	MemoryBytes     uint64    `json:"memory-bytes"`
+	BlockReadBytes  uint64    `json:"block-read-bytes"`
+	BlockWriteBytes uint64    `json:"block-write-bytes"`
+	NetworkRxBytes  uint64    `json:"network-rx-bytes"`
+	NetworkTxBytes  uint64    `json:"network-tx-bytes"`
+}
+
+type StatsSummary struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+	P95 float64 `json:"p95"`
+}
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) < 1 {
+		return 0
+	}
+
+	i := int(math.Ceil(float64(len(sorted))*p/100)) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
+
+func summarize(values []float64) (s StatsSummary) {
+	if len(values) < 1 {
+		return
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+
+	s.Min = sorted[0]
+	s.Max = sorted[len(sorted)-1]
+	s.Avg = sum / float64(len(sorted))
+	s.P95 = percentile(sorted, 95)
+
+	return
+}
+
+// statsValues converts the samples of one container to the values of each
+// metric; the cumulative I/O bytes are converted to the rate per second.
+func statsValues(samples []StatsSample) map[string][]float64 {
+	values := map[string][]float64{}
+	for i, s := range samples {
+		values["cpu-percent"] = append(values["cpu-percent"], s.CPUPercent)
+		values["memory-bytes"] = append(values["memory-bytes"], float64(s.MemoryBytes))
+
+		if i < 1 {
+			continue
+		}
+
+		prev := samples[i-1]
+		elapsed := s.Time.Sub(prev.Time).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+
+		rate := func(c, p uint64) float64 {
+			if c < p { // the counter is reset by restarting container
+				return 0
+			}
+			return float64(c-p) / elapsed
+		}
+
+		values["block-read-bytes/s"] = append(values["block-read-bytes/s"], rate(s.BlockReadBytes, prev.BlockReadBytes))
+		values["block-write-bytes/s"] = append(values["block-write-bytes/s"], rate(s.BlockWriteBytes, prev.BlockWriteBytes))
+		values["network-rx-bytes/s"] = append(values["network-rx-bytes/s"], rate(s.NetworkRxBytes, prev.NetworkRxBytes))
+		values["network-tx-bytes/s"] = append(values["network-tx-bytes/s"], rate(s.NetworkTxBytes, prev.NetworkTxBytes))
+	}
+
+	return values
+}
+
+// summarizeStats returns the summaries of each container and of all the
+// containers, which is keyed by `statsAggregateName`.
+func summarizeStats(samples map[string][]StatsSample) map[string]map[string]StatsSummary {
+	summaries := map[string]map[string]StatsSummary{}
+	all := map[string][]float64{}
+
+	for name, ss := range samples {
+		summaries[name] = map[string]StatsSummary{}
+		for metric, values := range statsValues(ss) {
+			summaries[name][metric] = summarize(values)
+			all[metric] = append(all[metric], values...)
+		}
+	}
+
+	summaries[statsAggregateName] = map[string]StatsSummary{}
+	for metric, values := range all {
+		summaries[statsAggregateName][metric] = summarize(values)
+	}
+
+	return summaries
+}
+
+func sampleStats(dh *DockerHost, c types.Container) (sample StatsSample, err error) {
+	var stats types.StatsJSON
+	if stats, err = getContainerStats(dh.Client(), c.ID); err != nil {
+		return
+	}
+
+	sample = StatsSample{
+		Time:        time.Now(),
+		Host:        dh.Name,
+		Container:   GetContainerName(c.Names),
+		CPUPercent:  cpuPercent(stats),
+		MemoryBytes: stats.MemoryStats.Usage,
+	}
+	sample.BlockReadBytes, sample.BlockWriteBytes = blockIO(stats)
+	sample.NetworkRxBytes, sample.NetworkTxBytes = networkIO(stats)
+
+	return
+}
+
+func printStatsSummaries(w io.Writer, summaries map[string]map[string]StatsSummary) error {
+	var names []string
+	for name := range summaries {
+		if name != statsAggregateName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append(names, statsAggregateName)
+
+	if flagOutput == "json" {
+		b, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+
+	header := []string{"container", "metric", "min", "avg", "max", "p95"}
+	var rows [][]string
+	for _, name := range names {
+		for _, metric := range statsMetricNames {
+			s, found := summaries[name][metric]
+			if !found {
+				continue
+			}
+			rows = append(rows, []string{
+				name,
+				metric,
+				fmt.Sprintf("%.2f", s.Min),
+				fmt.Sprintf("%.2f", s.Avg),
+				fmt.Sprintf("%.2f", s.Max),
+				fmt.Sprintf("%.2f", s.P95),
+			})
+		}
+	}
+
+	if flagOutput == "csv" {
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+
+	printTable(w, header, rows, make([]bool, len(rows)), false)
+
+	return nil
+}
+
+// exportStatsSamples writes all the samples into file; the format is decided
+// by the extension, `.json` or `.csv`.
+func exportStatsSamples(f string, samples map[string][]StatsSample) error {
+	var all []StatsSample
+	for _, ss := range samples {
+		all = append(all, ss...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].Time.Equal(all[j].Time) {
+			return all[i].Time.Before(all[j].Time)
+		}
+		return all[i].Container < all[j].Container
+	})
+
+	o, err := os.Create(f)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+
+	if filepath.Ext(f) == ".json" {
+		enc := json.NewEncoder(o)
+		enc.SetIndent("", "  ")
+		return enc.Encode(all)
+	}
+
+	cw := csv.NewWriter(o)
+	cw.Write([]string{
+		"time", "host", "container", "cpu-percent", "memory-bytes",
+		"block-read-bytes", "block-write-bytes", "network-rx-bytes", "network-tx-bytes",
+	})
+	for _, s := range all {
+		cw.Write([]string{
+			s.Time.Format(time.RFC3339Nano),
+			s.Host,
+			s.Container,
+			fmt.Sprintf("%f", s.CPUPercent),
+			fmt.Sprintf("%d", s.MemoryBytes),
+			fmt.Sprintf("%d", s.BlockReadBytes),
+			fmt.Sprintf("%d", s.BlockWriteBytes),
+			fmt.Sprintf("%d", s.NetworkRxBytes),
+			fmt.Sprintf("%d", s.NetworkTxBytes),
+		})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func init() {
+	statsCmd = &cobra.Command{
+		Use:   "stats <config>",
+		Short: "collect resource usage of sebak containers",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var err error
+			if config, err = parseConfig(args[0]); err != nil {
+				return PrintFlagsError(statsCmd, "<config>", err)
+			}
+
+			if err = parseStartFlags(); err != nil {
+				return err
+			}
+			var hosts []*DockerHost
+			if hosts, err = connectNodeHosts(flagNodes); err != nil {
+				return err
+			}
+
+			switch flagOutput {
+			case "table", "csv", "json":
+			default:
+				return PrintFlagsError(statsCmd, "--output", fmt.Errorf("unknown output format, '%s'", flagOutput))
+			}
+			if flagStatsInterval <= 0 || flagStatsDuration < flagStatsInterval {
+				return PrintFlagsError(statsCmd, "--interval", fmt.Errorf("must be greater than 0 and less than --duration"))
+			}
+			if len(flagStatsExport) > 0 {
+				switch filepath.Ext(flagStatsExport) {
+				case ".csv", ".json":
+				default:
+					return PrintFlagsError(statsCmd, "--export", fmt.Errorf("must be .csv or .json file"))
+				}
+			}
+
+			// get container info
+			containers := map[*DockerHost][]types.Container{}
+			var numContainers int
+			m := composer.NewNodeMatcher(flagNodes)
+			for _, dh := range hosts {
+				cl, err := composer.Containers(rootContext, dh, composerOptions())
+				if err != nil {
+					log.Error("failed to get containers", "error", err)
+					return reported(exitCodeError, err)
+				}
+				for _, c := range cl {
+					if !m.Match(dh, GetContainerName(c.Names)) || c.State != "running" {
+						continue
+					}
+					containers[dh] = append(containers[dh], c)
+					numContainers++
+				}
+			}
+
+			if err = m.Err(); err != nil {
+				return PrintFlagsError(statsCmd, "--node", err)
+			}
+
+			if numContainers < 1 {
+				return PrintError(statsCmd, fmt.Errorf("running containers not found"))
+			}
+
+			samples := map[string][]StatsSample{}
+			var lock sync.Mutex
+
+			ticker := time.NewTicker(flagStatsInterval)
+			defer ticker.Stop()
+
+			ch := Ticker()
+			end := time.Now().Add(flagStatsDuration)
+			for {
+				var wg sync.WaitGroup
+				wg.Add(numContainers)
+				for dh, cl := range containers {
+					for _, c := range cl {
+						go func(dh *DockerHost, c types.Container) {
+							defer wg.Done()
+
+							sample, err := sampleStats(dh, c)
+							if err != nil {
+								log.Error("failed to get stats", "container", GetContainerName(c.Names), "error", err)
+								return
+							}
+
+							lock.Lock()
+							samples[sample.Container] = append(samples[sample.Container], sample)
+							lock.Unlock()
+						}(dh, c)
+					}
+				}
+				wg.Wait()
+
+				if time.Now().After(end) || canceled() {
+					break
+				}
+				select {
+				case <-ticker.C:
+				case <-rootContext.Done():
+				}
+			}
+			ch <- true
+
+			if len(flagStatsExport) > 0 {
+				if err = exportStatsSamples(flagStatsExport, samples); err != nil {
+					log.Error("failed to export samples", "file", flagStatsExport, "error", err)
+					return reported(exitCodeError, err)
+				}
+			}
+
+			if err = printStatsSummaries(os.Stdout, summarizeStats(samples)); err != nil {
+				log.Error("failed to print summaries", "error", err)
+				return reported(exitCodeError, err)
+			}
+
+			return nil
+		},
+	}
+
+	statsCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+	statsCmd.Flags().DurationVar(&flagStatsDuration, "duration", flagStatsDuration, "duration to collect")
+	statsCmd.Flags().DurationVar(&flagStatsInterval, "interval", flagStatsInterval, "sampling interval")
+	statsCmd.Flags().StringVar(&flagOutput, "output", flagOutput, "output format of summaries, {table, csv, json}")
+	statsCmd.Flags().StringVar(&flagStatsExport, "export", flagStatsExport, "export all the samples into .csv or .json file")
+	statsCmd.Flags().Var(&flagNodes, "node", "host name, container name, node alias or node address to collect; can be given multiple times")
+
+	rootCmd.AddCommand(statsCmd)
+}
@@ -1,29 +1,26 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"strings"
-	"sync"
 
-	"github.com/docker/docker/api/types"
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 var (
 	stopCmd *cobra.Command
 )
 
-func parseStopFlags() {
+func parseStopFlags() error {
 	{
 		var err error
 		var logLevel logging.Lvl
 		if logLevel, err = logging.LvlFromString(flagLogLevel); err != nil {
-			fmt.Printf("invalid `log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `log-level`: %v", err)
 		}
 
 		var formatter logging.Format
@@ -41,10 +38,11 @@ func parseStopFlags() {
 	{
 		var err error
 		if _, err = logging.LvlFromString(flagSebakLogLevel); err != nil {
-			fmt.Printf("invalid `sebak-log-level`: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid `sebak-log-level`: %v", err)
 		}
 	}
+
+	return nil
 }
 
 func init() {
@@ -52,63 +50,34 @@ func init() {
 		Use:   "stop <config>",
 		Short: "stop sebak containers",
 		Args:  cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, args []string) {
+		RunE: func(c *cobra.Command, args []string) error {
 			var err error
 			if config, err = parseConfig(args[0]); err != nil {
-				PrintFlagsError(runCmd, "<config>", err)
+				return PrintFlagsError(stopCmd, "<config>", err)
 			}
 
-			parseStopFlags()
-
-			// get container info
-			containers := map[string][]types.Container{}
-			var numContainers int
-			for _, dh := range config.DockerHosts {
-				cl, err := findContainersByPrefix(dh.Client(), "scn.")
-				if err != nil {
-					log.Error("failed to get containers", "error", err)
-					os.Exit(1)
-				}
-				if _, found := containers[dh.Host]; !found {
-				}
-				containers[dh.Host] = append(containers[dh.Host], cl...)
-				numContainers++
+			if err = parseStopFlags(); err != nil {
+				return err
 			}
-
-			var wg sync.WaitGroup
-
-			var containerNames []string
-			for _, cls := range containers {
-				for _, c := range cls {
-					containerNames = append(containerNames, GetContainerName(c.Names))
-				}
-			}
-
-			fmt.Printf("containers: %s\n", strings.Join(containerNames, ", "))
-
-			wg.Add(len(containerNames))
-			for dhHost, cls := range containers {
-				dh, found := config.GetDockerHost(dhHost)
-				if !found {
-					PrintError(stopCmd, fmt.Errorf("unknown host key found: %s", dhHost))
-				}
-				for _, c := range cls {
-					go func(c types.Container) {
-						defer wg.Done()
-						err := dh.Client().ContainerStop(context.Background(), c.ID, nil)
-						if err != nil {
-							log.Error("failed to stop", "error", err)
-						}
-					}(c)
-				}
+			if _, err = connectNodeHosts(flagNodes); err != nil {
+				return err
 			}
 
 			ch := Ticker()
-			wg.Wait()
+			names, err := composer.Stop(rootContext, config, composer.StopOptions{Options: composerOptions(), Nodes: flagNodes})
 			ch <- true
+
+			fmt.Printf("containers: %s\n", strings.Join(names, ", "))
+			if err != nil {
+				return err
+			}
 			log.Debug("done")
+
+			return nil
 		},
 	}
 
+	stopCmd.Flags().Var(&flagNodes, "node", "host name, container name, node alias or node address to stop; can be given multiple times")
+
 	rootCmd.AddCommand(stopCmd)
 }
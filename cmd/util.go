@@ -1,28 +1,21 @@
 package cmd
 
 import (
-	"context"
+	"bytes"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"os"
-	"os/user"
-	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 
-	"github.com/BurntSushi/toml"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/tlsconfig"
 	"github.com/spf13/cobra"
 
-	"boscoin.io/sebak/lib/common/keypair"
-	"boscoin.io/sebak/lib/node"
+	"github.com/spikeekips/sebak-network-composer/composer"
 )
 
 type FlagEnv []string
@@ -70,24 +63,32 @@ func (f *FlagVolume) Set(v string) error {
 	return nil
 }
 
-func PrintFlagsError(cmd *cobra.Command, flagName string, err error) {
+// PrintFlagsError prints the error of flag with the help of command and
+// returns it as the reported error; the command should return it.
+func PrintFlagsError(cmd *cobra.Command, flagName string, err error) error {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: invalid '%s'; %v\n\n", flagName, err)
+	} else {
+		err = fmt.Errorf("invalid '%s'", flagName)
 	}
 
 	cmd.Help()
 
-	os.Exit(1)
+	return reported(exitCodeError, err)
 }
 
-func PrintError(cmd *cobra.Command, err error) {
+// PrintError is like `PrintFlagsError`, but for the error, which is not
+// about flag.
+func PrintError(cmd *cobra.Command, err error) error {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n\n", err)
+	} else {
+		err = fmt.Errorf("invalid usage")
 	}
 
 	cmd.Help()
 
-	os.Exit(1)
+	return reported(exitCodeError, err)
 }
 
 type ListFlags []string
@@ -105,112 +106,10 @@ func (i *ListFlags) Set(value string) error {
 	return nil
 }
 
-type Volume struct {
-	Source string
-	Target string
-}
-
-func (v *Volume) UnmarshalText(b []byte) error {
-	a := strings.SplitN(string(b), ":", 2)
-	if len(a) != 2 {
-		return fmt.Errorf("invalid volume: '%v'", string(b))
-	}
-
-	v.Source = a[0]
-	v.Target = a[1]
-
-	return nil
-}
-
-type DockerHost struct {
-	Host    string   `toml:"host"`
-	Ca      string   `toml:"ca"`
-	Cert    string   `toml:"cert"`
-	CertKey string   `toml:"cert_key"`
-	Volume  []Volume `toml:"volume"`
-	Env     []string `toml:"env"`
-	Seeds   []string `toml:"seeds"`
-
-	client *client.Client
-	IP     string
-	Nodes  []*node.LocalNode
-	Keys   []*keypair.Full
-}
-
 func NewDockerHostFromURI(uri string) (dh *DockerHost, err error) {
 	return
 }
 
-func (dh *DockerHost) CheckClient() (err error) {
-	if dh.client != nil {
-		return nil
-	}
-
-	var u *url.URL
-	if u, err = url.Parse(dh.Host); err != nil {
-		return
-	}
-
-	if len(dh.Ca) < 1 {
-		err = fmt.Errorf("`ca` is missing")
-		return
-	}
-
-	if len(dh.Cert) < 1 {
-		err = fmt.Errorf("`cert` is missing")
-		return
-	}
-
-	if len(dh.CertKey) < 1 {
-		err = fmt.Errorf("`cert_key` is missing")
-		return
-	}
-
-	dh.Ca = patchHomeDir(dh.Ca)
-	dh.Cert = patchHomeDir(dh.Cert)
-	dh.CertKey = patchHomeDir(dh.CertKey)
-
-	u.RawQuery = ""
-	dh.Host = u.String()
-
-	options := tlsconfig.Options{
-		CAFile:             dh.Ca,
-		CertFile:           dh.Cert,
-		KeyFile:            dh.CertKey,
-		InsecureSkipVerify: os.Getenv("DOCKER_TLS_VERIFY") == "",
-	}
-
-	var tlsc *tls.Config
-	if tlsc, err = tlsconfig.Client(options); err != nil {
-		return err
-	}
-
-	c := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsc,
-		},
-	}
-
-	var cl *client.Client
-	if cl, err = client.NewClient(dh.Host, "", c, nil); err != nil {
-		return err
-	}
-
-	ctx := context.Background()
-	_, err = cl.ContainerList(ctx, types.ContainerListOptions{All: true})
-	if err != nil {
-		return err
-	}
-
-	dh.client = cl
-
-	return nil
-}
-
-func (dh *DockerHost) Client() *client.Client {
-	return dh.client
-}
-
 func Ticker() chan bool {
 	ch := make(chan bool)
 	go func() {
@@ -234,101 +133,102 @@ func Ticker() chan bool {
 	return ch
 }
 
-type Config struct {
-	Genesis     string                `toml:"genesis"`
-	Common      string                `toml:"common"`
-	DockerPath  string                `toml:"docker-path"`
-	Hosts       map[string]DockerHost `toml:"hosts"`
-	DockerHosts []*DockerHost
-	dockerHosts map[string]*DockerHost
-}
+// connectAllHosts connects to all the docker hosts for the commands, which work
+// on every host.
+func connectAllHosts() error {
+	err := config.Connect(rootContext, composer.ConnectOptions{
+		Timeout:         flagDockerTimeout,
+		SkipUnreachable: flagSkipUnreachable,
+	})
+	for _, u := range config.Unreachable {
+		fmt.Fprintf(os.Stderr, "warning: %v; skipped\n", u.Error)
+	}
 
-func (c *Config) GetDockerHost(host string) (dh *DockerHost, found bool) {
-	dh, found = c.dockerHosts[host]
-	return
+	return err
 }
 
-func parseConfig(f string) (conf *Config, err error) {
-	var i *os.File
-	if i, err = os.Open(f); err != nil {
-		return
+// connectHosts connects to the given docker hosts for the commands, which work
+// on the selected hosts; any unreachable host is error.
+func connectHosts(hosts []*DockerHost) error {
+	var errs composer.MultiError
+	for _, err := range composer.ConnectHosts(rootContext, hosts, flagDockerTimeout) {
+		errs.Append(err)
 	}
 
-	var b []byte
-	if b, err = ioutil.ReadAll(i); err != nil {
-		return
-	}
+	return errs.ErrorOrNil()
+}
 
-	if _, err = toml.Decode(string(b), &conf); err != nil {
-		return
+// connectNodeHosts connects to the docker hosts of the nodes, which the node
+// selectors point and returns the hosts; without selector, it is same with
+// `connectAllHosts`. See `composer.Config.SelectHosts`.
+func connectNodeHosts(selectors []string) ([]*DockerHost, error) {
+	if len(selectors) < 1 {
+		err := connectAllHosts()
+		return config.DockerHosts, err
 	}
 
-	m := map[string]*DockerHost{}
-	var hosts []string
-	for _, h := range conf.Hosts {
-		var keys []*keypair.Full
-		for _, s := range h.Seeds {
-			var kp keypair.KP
-			if kp, err = keypair.Parse(s); err != nil {
-				return
-			} else if full, ok := kp.(*keypair.Full); !ok {
-				err = fmt.Errorf("public address found")
-				return
-			} else {
-				keys = append(keys, full)
-			}
-		}
+	hosts := config.SelectHosts(selectors)
 
-		dh := &DockerHost{
-			Host:    h.Host,
-			Ca:      h.Ca,
-			Cert:    h.Cert,
-			CertKey: h.CertKey,
-			Volume:  h.Volume,
-			Env:     h.Env,
-			Keys:    keys,
-		}
-		if err = dh.CheckClient(); err != nil {
-			return
-		}
+	return hosts, connectHosts(hosts)
+}
 
-		m[dh.Host] = dh
-		hosts = append(hosts, dh.Host)
-	}
+// parseConfig loads the config file; the created common keypair is printed.
+func parseConfig(f string) (conf *Config, err error) {
+	conf, err = composer.LoadConfig(f, composer.LoadOptions{Output: os.Stdout})
 
-	sort.Strings(hosts)
-	for _, k := range hosts {
-		conf.DockerHosts = append(conf.DockerHosts, m[k])
-	}
+	return
+}
+
+// parseRunConfig is like `parseConfig`, but the random genesis account is
+// created for the new network if it is not set in config.
+func parseRunConfig(f string) (conf *Config, err error) {
+	conf, err = composer.LoadConfig(f, composer.LoadOptions{Output: os.Stdout, CreateGenesis: true})
 
-	conf.dockerHosts = m
+	return
+}
 
-	if len(conf.Genesis) < 1 {
-		kp := keypair.Random()
-		conf.Genesis = kp.Address()
-		fmt.Println("genesis keypair created", "seed", kp.Seed(), "address", kp.Address())
+// filterDockerHosts returns the docker hosts matching with the given
+// selectors; the selector can be host name or host address. If no selector is
+// given, all the hosts are returned.
+func filterDockerHosts(hosts []*DockerHost, selectors []string) (filtered []*DockerHost) {
+	if len(selectors) < 1 {
+		return hosts
 	}
-	if len(conf.Common) < 1 {
-		kp := keypair.Random()
-		conf.Common = kp.Address()
-		fmt.Println("common keypair created", "seed", kp.Seed(), "address", kp.Address())
+
+	for _, dh := range hosts {
+		for _, s := range selectors {
+			if s == dh.Name || s == dh.Host {
+				filtered = append(filtered, dh)
+				break
+			}
+		}
 	}
 
 	return
 }
 
-func HTTPGet(u string) (body []byte, err error) {
-	client := &http.Client{
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: flagHTTPTimeout,
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: true,
 			},
 		},
 	}
+}
+
+func HTTPGet(u string) (body []byte, err error) {
+	var req *http.Request
+	if req, err = http.NewRequest("GET", u, nil); err != nil {
+		return
+	}
+
 	var resp *http.Response
-	if resp, err = client.Get(u); err != nil {
+	if resp, err = newHTTPClient().Do(req.WithContext(rootContext)); err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("failed to get; status=%v", resp.StatusCode)
@@ -342,19 +242,120 @@ func HTTPGet(u string) (body []byte, err error) {
 	return
 }
 
-func GetContainerName(s []string) string {
-	if len(s) < 1 {
-		return ""
+// HTTPPost posts the json body; unlike HTTPGet, any 2xx status is accepted
+// and the error contains the response body.
+func HTTPPost(u string, b []byte) (body []byte, err error) {
+	var req *http.Request
+	if req, err = http.NewRequest("POST", u, bytes.NewReader(b)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp *http.Response
+	if resp, err = newHTTPClient().Do(req.WithContext(rootContext)); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("failed to post; status=%v: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return
+	}
+
+	return
+}
+
+func getNodeInfo(endpoint string) (info NodeInfo, err error) {
+	var b []byte
+	if b, err = HTTPGet(endpoint); err != nil {
+		return
 	}
 
-	return s[0][1:]
+	err = json.Unmarshal(b, &info)
+
+	return
 }
 
-func patchHomeDir(s string) string {
-	if !strings.HasPrefix(s, "~") {
-		return s
+// BlockInfo is the response of block API of SEBAK node.
+type BlockInfo struct {
+	Hash         string   `json:"hash"`
+	Height       uint64   `json:"height"`
+	Proposer     string   `json:"proposer"`
+	Round        uint64   `json:"round"`
+	Transactions []string `json:"transactions"`
+	Confirmed    string   `json:"confirmed"`
+}
+
+func getBlock(endpoint string, hashOrHeight string) (block BlockInfo, err error) {
+	var b []byte
+	if b, err = HTTPGet(fmt.Sprintf("%s%s/%s", strings.TrimRight(endpoint, "/"), apiBlocksPath, hashOrHeight)); err != nil {
+		return
 	}
 
-	u, _ := user.Current()
-	return filepath.Join(u.HomeDir, s[2:])
+	err = json.Unmarshal(b, &block)
+
+	return
+}
+
+// AccountInfo is the response of account API of SEBAK node.
+type AccountInfo struct {
+	Address    string `json:"address"`
+	Balance    string `json:"balance"`
+	SequenceID uint64 `json:"sequence_id"`
+	Linked     string `json:"linked"`
+}
+
+func getAccount(endpoint string, address string) (account AccountInfo, err error) {
+	var b []byte
+	if b, err = HTTPGet(fmt.Sprintf("%s%s/%s", strings.TrimRight(endpoint, "/"), apiAccountsPath, address)); err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &account)
+
+	return
+}
+
+// printTable prints the rows as table; if colored, the highlighted rows are
+// printed in red, if not, they are marked with '*'.
+func printTable(w io.Writer, header []string, rows [][]string, highlighted []bool, colored bool) {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = len(h)
+	}
+	for _, row := range rows {
+		for i, c := range row {
+			if len(c) > widths[i] {
+				widths[i] = len(c)
+			}
+		}
+	}
+
+	line := func(mark string, row []string) string {
+		cells := make([]string, len(row))
+		for i, c := range row {
+			cells[i] = c + strings.Repeat(" ", widths[i]-len(c))
+		}
+		return strings.TrimRight(mark+" "+strings.Join(cells, "  "), " ")
+	}
+
+	fmt.Fprintln(w, line(" ", header))
+	for i, row := range rows {
+		switch {
+		case !highlighted[i]:
+			fmt.Fprintln(w, line(" ", row))
+		case colored:
+			fmt.Fprintf(w, "\x1b[31m%s\x1b[0m\n", line(" ", row))
+		default:
+			fmt.Fprintln(w, line("*", row))
+		}
+	}
+}
+
+func GetContainerName(s []string) string {
+	return composer.ContainerShortName(s)
 }
@@ -0,0 +1,68 @@
+// Package composer composes the SEBAK network over the docker hosts. It is the
+// library behind the `sebak-network-composer` commands, so the integration
+// tests can deploy and remove the network directly:
+//
+//	conf, err := composer.LoadConfig("config.toml", composer.LoadOptions{CreateGenesis: true})
+//	...
+//	if _, err = composer.Compose(ctx, conf, composer.Options{}); err != nil {
+//		...
+//	}
+//	if _, err = composer.Deploy(ctx, conf, composer.DeployOptions{}); err != nil {
+//		...
+//	}
+//	defer composer.Remove(context.Background(), conf, composer.RemoveOptions{})
+//
+//	statuses, err := composer.Status(ctx, conf, composer.StatusOptions{})
+//
+// Every operation takes the context for cancellation and its options; no
+// package-level state is used.
+package composer
+
+import (
+	"context"
+	"time"
+
+	logging "github.com/inconshreveable/log15"
+)
+
+const (
+	// BasePort is the port of node in the docker network.
+	BasePort int = 12345
+	// BaseContainerPort is the first published port of nodes in a host.
+	BaseContainerPort int = 12000
+	// NetworkID is the network id of composed network.
+	NetworkID string = "test sebak-network"
+	// ContainerNamePrefix is the prefix of the name of node containers.
+	ContainerNamePrefix string = "scn."
+	// DefaultImage is the sebak image for nodes.
+	DefaultImage string = "boscoin/sebak-network-composer:latest"
+	// DefaultSebakLogLevel is the log level of nodes.
+	DefaultSebakLogLevel string = "debug"
+)
+
+// Options is the common options of operations.
+type Options struct {
+	// Log receives the progress of operation; by default, nothing is logged.
+	Log logging.Logger
+	// DockerTimeout limits each docker call; 0 is no limit.
+	DockerTimeout time.Duration
+}
+
+func (o Options) logger() logging.Logger {
+	if o.Log != nil {
+		return o.Log
+	}
+
+	l := logging.New()
+	l.SetHandler(logging.DiscardHandler())
+
+	return l
+}
+
+func (o Options) dockerContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.DockerTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, o.DockerTimeout)
+}
@@ -0,0 +1,220 @@
+package composer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spikeekips/sebak-network-composer/composer"
+	"github.com/spikeekips/sebak-network-composer/composer/composertest"
+)
+
+// testIP is the address of fake docker host; it differs from the one of cmd
+// tests, so the node ports are not conflicted when the packages are tested
+// in parallel.
+const testIP = "127.0.0.2"
+
+func composeTestNetwork(t *testing.T, nodes int) (*composertest.Server, *composer.Config, func()) {
+	s, err := composertest.NewServer(testIP)
+	if err != nil {
+		t.Fatalf("failed to start fake docker host: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "sebak-network-composer")
+	if err != nil {
+		s.Close()
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+
+	cleanup := func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+
+	p, err := composertest.WriteConfig(dir, map[string]*composertest.Server{"host0": s}, nodes)
+	if err != nil {
+		cleanup()
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	conf, err := composer.LoadConfig(p, composer.LoadOptions{CreateGenesis: true})
+	if err != nil {
+		cleanup()
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	if err = conf.Connect(ctx, composer.ConnectOptions{}); err != nil {
+		cleanup()
+		t.Fatalf("failed to connect docker hosts: %v", err)
+	}
+	if _, err = composer.Compose(ctx, conf, composer.Options{}); err != nil {
+		cleanup()
+		t.Fatalf("failed to compose network: %v", err)
+	}
+
+	return s, conf, cleanup
+}
+
+func deployTestNetwork(t *testing.T, conf *composer.Config) *composer.Deployment {
+	deployment, err := composer.Deploy(
+		context.Background(),
+		conf,
+		composer.DeployOptions{ReadinessWait: time.Second},
+	)
+	if err != nil {
+		t.Fatalf("failed to deploy: %v", err)
+	}
+
+	return deployment
+}
+
+func nodeContainerNames(s *composertest.Server) (names []string) {
+	for _, name := range s.ContainerNames() {
+		if strings.HasPrefix(name, composer.ContainerNamePrefix) {
+			names = append(names, name)
+		}
+	}
+
+	return
+}
+
+func TestDeploy(t *testing.T) {
+	s, conf, cleanup := composeTestNetwork(t, 3)
+	defer cleanup()
+
+	deployment := deployTestNetwork(t, conf)
+	if len(deployment.Nodes) != 3 {
+		t.Errorf("expected 3 nodes, but %d", len(deployment.Nodes))
+	}
+
+	for _, nd := range conf.DockerHosts[0].Nodes {
+		name := composer.ContainerName(nd)
+		if state, found := s.ContainerState(name); !found {
+			t.Errorf("container not found, '%s'", name)
+		} else if state != "running" {
+			t.Errorf("container, '%s' is not running: %s", name, state)
+		}
+	}
+
+	statuses, err := composer.Status(context.Background(), conf, composer.StatusOptions{})
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("expected 3 statuses, but %d", len(statuses))
+	}
+
+	for _, st := range statuses {
+		if st.Error != nil {
+			t.Errorf("failed to get node info of '%s': %v", st.Target.Container, st.Error)
+			continue
+		}
+		if _, found := deployment.Nodes[st.Info.Node.Address]; !found {
+			t.Errorf("unknown node address, '%s'", st.Info.Node.Address)
+		}
+		if st.Info.Node.State != "CONSENSUS" {
+			t.Errorf("node, '%s' is not in consensus: %s", st.Name(), st.Info.Node.State)
+		}
+		if st.Info.Block.Height != 1 {
+			t.Errorf("expected block height 1 of '%s', but %d", st.Name(), st.Info.Block.Height)
+		}
+	}
+}
+
+func TestLogs(t *testing.T) {
+	_, conf, cleanup := composeTestNetwork(t, 2)
+	defer cleanup()
+
+	deployTestNetwork(t, conf)
+
+	dir, err := ioutil.TempDir("", "sebak-network-composer-logs")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	names, err := composer.Logs(context.Background(), conf, dir, composer.LogsOptions{})
+	if err != nil {
+		t.Fatalf("failed to get logs: %v", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected logs of 2 containers, but %d", len(names))
+	}
+
+	for _, nd := range conf.DockerHosts[0].Nodes {
+		name := composer.ContainerName(nd)
+		b, err := ioutil.ReadFile(filepath.Join(dir, name+".log"))
+		if err != nil {
+			t.Errorf("failed to read log of '%s': %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(b), "node started") {
+			t.Errorf("unexpected log of '%s': %q", name, string(b))
+		}
+	}
+}
+
+func TestStopAndRemove(t *testing.T) {
+	s, conf, cleanup := composeTestNetwork(t, 2)
+	defer cleanup()
+
+	deployTestNetwork(t, conf)
+
+	ctx := context.Background()
+	stopped, err := composer.Stop(ctx, conf, composer.StopOptions{})
+	if err != nil {
+		t.Fatalf("failed to stop: %v", err)
+	}
+	if len(stopped) != 2 {
+		t.Errorf("expected 2 stopped containers, but %d", len(stopped))
+	}
+	for _, name := range nodeContainerNames(s) {
+		if state, _ := s.ContainerState(name); state != "exited" {
+			t.Errorf("container, '%s' is not stopped: %s", name, state)
+		}
+	}
+
+	removed, err := composer.Remove(ctx, conf, composer.RemoveOptions{})
+	if err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("expected 2 removed containers, but %d", len(removed))
+	}
+	if names := nodeContainerNames(s); len(names) > 0 {
+		t.Errorf("node containers are not removed: %v", names)
+	}
+}
+
+// TestDeployRemovesCreatedOnFailure checks that the failed deploy does not
+// leave the containers, which it created.
+func TestDeployRemovesCreatedOnFailure(t *testing.T) {
+	s, conf, cleanup := composeTestNetwork(t, 2)
+	defer cleanup()
+
+	deployTestNetwork(t, conf)
+
+	name := composer.ContainerName(conf.DockerHosts[0].Nodes[0])
+	ctx := context.Background()
+	if _, err := composer.Remove(ctx, conf, composer.RemoveOptions{Nodes: []string{name}}); err != nil {
+		t.Fatalf("failed to remove '%s': %v", name, err)
+	}
+
+	// the other node container still exists, so deploying without `Force`
+	// fails.
+	if _, err := composer.Deploy(ctx, conf, composer.DeployOptions{ReadinessWait: time.Second}); err == nil {
+		t.Fatal("deploy over the existing containers must fail")
+	}
+
+	if _, found := s.ContainerState(name); found {
+		t.Errorf("container, '%s' created by the failed deploy is not removed", name)
+	}
+	if names := nodeContainerNames(s); len(names) != 1 {
+		t.Errorf("expected the existing container only, but %v", names)
+	}
+}
@@ -0,0 +1,99 @@
+// Package composertest provides the fake docker daemon and the fake SEBAK
+// nodes to run composer without the real docker hosts, like
+// `net/http/httptest`:
+//
+//	s, err := composertest.NewServer("")
+//	...
+//	defer s.Close()
+//
+//	p, err := composertest.WriteConfig(dir, map[string]*composertest.Server{"host0": s}, 3)
+//	conf, err := composer.LoadConfig(p, composer.LoadOptions{CreateGenesis: true})
+//	...
+//	_, err = composer.Compose(ctx, conf, composer.Options{})
+//	_, err = composer.Deploy(ctx, conf, composer.DeployOptions{})
+//	statuses, err := composer.Status(ctx, conf, composer.StatusOptions{})
+//
+// The config can also be given to the commands, like `sebak-network-composer
+// run <config>`.
+package composertest
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"boscoin.io/sebak/lib/common/keypair"
+)
+
+// writeCerts writes the certificate and key of the server for the docker
+// client; the certificate is also used as ca.
+func (s *Server) writeCerts(dir string) (ca, cert, key string, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	c := s.srv.TLS.Certificates[0]
+
+	var der []byte
+	if der, err = x509.MarshalPKCS8PrivateKey(c.PrivateKey); err != nil {
+		return
+	}
+
+	ca = filepath.Join(dir, "ca.pem")
+	cert = filepath.Join(dir, "cert.pem")
+	key = filepath.Join(dir, "key.pem")
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate[0]})
+	for _, f := range []string{ca, cert} {
+		if err = ioutil.WriteFile(f, certPEM, 0644); err != nil {
+			return
+		}
+	}
+	err = ioutil.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	return
+}
+
+// WriteConfig writes the config file, `<dir>/config.toml` for the servers by
+// host name and returns the path; every host has the given number of nodes
+// with the random keys.
+func WriteConfig(dir string, servers map[string]*Server, nodes int) (p string, err error) {
+	var names []string
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{"[hosts]"}
+	for _, name := range names {
+		var ca, cert, key string
+		if ca, cert, key, err = servers[name].writeCerts(filepath.Join(dir, name)); err != nil {
+			return
+		}
+
+		var seeds []string
+		for i := 0; i < nodes; i++ {
+			seeds = append(seeds, fmt.Sprintf("%q", keypair.Random().Seed()))
+		}
+
+		lines = append(
+			lines,
+			fmt.Sprintf("  [hosts.%s]", name),
+			fmt.Sprintf("  host = %q", servers[name].Host()),
+			fmt.Sprintf("  ca = %q", ca),
+			fmt.Sprintf("  cert = %q", cert),
+			fmt.Sprintf("  cert_key = %q", key),
+			fmt.Sprintf("  seeds = [%s]", strings.Join(seeds, ", ")),
+		)
+	}
+
+	p = filepath.Join(dir, "config.toml")
+	err = ioutil.WriteFile(p, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	return
+}
@@ -0,0 +1,832 @@
+package composertest
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+var reAPIVersion = regexp.MustCompile(`^/v[0-9.]+`)
+
+type fakeContainer struct {
+	ID         string
+	Name       string
+	Image      string
+	ImageID    string
+	Created    time.Time
+	Config     *container.Config
+	HostConfig *container.HostConfig
+	State      string
+	ExitCode   int
+	Logs       bytes.Buffer
+	Files      map[string][]byte
+	Dirs       map[string]bool
+	Node       *Node
+}
+
+func (c *fakeContainer) isSEBAK() bool {
+	for _, e := range c.Config.Entrypoint {
+		if e == "/entrypoint.sh" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *fakeContainer) env(key string) string {
+	for _, e := range c.Config.Env {
+		if strings.HasPrefix(e, key+"=") {
+			return e[len(key)+1:]
+		}
+	}
+
+	return ""
+}
+
+func (c *fakeContainer) status() string {
+	switch c.State {
+	case "running":
+		return fmt.Sprintf("Up %s", time.Since(c.Created).Truncate(time.Second))
+	case "paused":
+		return "Up (Paused)"
+	case "exited":
+		return fmt.Sprintf("Exited (%d)", c.ExitCode)
+	default:
+		return "Created"
+	}
+}
+
+// Server is the fake docker daemon; it keeps the containers, images and
+// networks in memory and implements the subset of the Docker Engine API,
+// which composer uses. The containers do not run anything: the sebak
+// containers start the fake SEBAK node and the other containers exit at once;
+// the container to get the internal ip prints `IP`.
+type Server struct {
+	// IP is the address of docker host; the fake nodes listen on it.
+	IP string
+
+	lock       sync.Mutex
+	srv        *httptest.Server
+	containers map[string]*fakeContainer
+	images     map[string][]string
+	networks   map[string]types.NetworkResource
+	seq        int
+}
+
+// NewServer starts the fake docker daemon on the ip, by default, 127.0.0.1;
+// the image of `composer.DefaultImage` exists already. To run several docker
+// hosts, give the different loopback addresses like 127.0.0.2, otherwise the
+// ports of nodes will be conflicted.
+func NewServer(ip string) (s *Server, err error) {
+	if len(ip) < 1 {
+		ip = "127.0.0.1"
+	}
+
+	var l net.Listener
+	if l, err = net.Listen("tcp", net.JoinHostPort(ip, "0")); err != nil {
+		return
+	}
+
+	s = &Server{
+		IP:         ip,
+		containers: map[string]*fakeContainer{},
+		images:     map[string][]string{},
+		networks:   map[string]types.NetworkResource{},
+	}
+	s.AddImage(composer.DefaultImage)
+
+	s.srv = httptest.NewUnstartedServer(s)
+	s.srv.Listener.Close()
+	s.srv.Listener = l
+	s.srv.StartTLS()
+
+	return
+}
+
+// Host returns the docker host address for config, like
+// 'tcp://127.0.0.1:2376'.
+func (s *Server) Host() string {
+	return "tcp://" + s.srv.Listener.Addr().String()
+}
+
+// Close stops the fake nodes and the daemon.
+func (s *Server) Close() {
+	s.lock.Lock()
+	for _, c := range s.containers {
+		if c.Node != nil {
+			c.Node.Close()
+		}
+	}
+	s.lock.Unlock()
+
+	s.srv.Close()
+}
+
+func (s *Server) newID() string {
+	s.seq++
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d", s.IP, s.seq))))
+}
+
+// AddImage adds the image of the tag and returns the image id.
+func (s *Server) AddImage(tag string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.addImage(tag)
+}
+
+func (s *Server) addImage(tag string) string {
+	for id, tags := range s.images {
+		for _, t := range tags {
+			if t == tag {
+				return id
+			}
+		}
+	}
+
+	id := "sha256:" + s.newID()
+	s.images[id] = []string{tag}
+
+	return id
+}
+
+// RemoveImage removes the image of the tag, for example, to make
+// `composer.ImageMissingError`.
+func (s *Server) RemoveImage(tag string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if id, found := s.findImage(tag); found {
+		delete(s.images, id)
+	}
+}
+
+func (s *Server) findImage(ref string) (string, bool) {
+	if _, found := s.images[ref]; found {
+		return ref, true
+	}
+
+	for id, tags := range s.images {
+		for _, t := range tags {
+			if t == ref || t == ref+":latest" {
+				return id, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// ContainerNames returns the names of all the containers.
+func (s *Server) ContainerNames() (names []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, c := range s.containers {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// ContainerState returns the state of container, like "running" and
+// "exited".
+func (s *Server) ContainerState(name string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, found := s.findContainer(name)
+	if !found {
+		return "", false
+	}
+
+	return c.State, true
+}
+
+// Crash makes the container exit with the exit code and the log, like the
+// node is crashed.
+func (s *Server) Crash(name string, exitCode int, log string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, found := s.findContainer(name)
+	if !found {
+		return fmt.Errorf("container not found, '%s'", name)
+	}
+
+	c.Logs.WriteString(log)
+	s.stop(c, exitCode)
+
+	return nil
+}
+
+// SetBlock sets the latest block of the fake node of container; if the hash
+// is empty, it is derived from the height, so the nodes of same height agree.
+func (s *Server) SetBlock(name string, height uint64, hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, found := s.findContainer(name)
+	if !found || c.Node == nil {
+		return fmt.Errorf("node not found, '%s'", name)
+	}
+
+	c.Node.SetBlock(height, hash)
+
+	return nil
+}
+
+// ReadFile returns the content of file in the container.
+func (s *Server) ReadFile(name, p string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, found := s.findContainer(name)
+	if !found {
+		return nil, false
+	}
+
+	b, found := c.Files[path.Clean(p)]
+	return b, found
+}
+
+// WriteFile writes the file into the container; the parent directories are
+// created.
+func (s *Server) WriteFile(name, p string, b []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, found := s.findContainer(name)
+	if !found {
+		return fmt.Errorf("container not found, '%s'", name)
+	}
+
+	writeFile(c, path.Clean(p), b)
+
+	return nil
+}
+
+func writeFile(c *fakeContainer, p string, b []byte) {
+	for d := path.Dir(p); d != "/" && d != "."; d = path.Dir(d) {
+		c.Dirs[d] = true
+	}
+	c.Files[p] = b
+}
+
+func (s *Server) findContainer(s0 string) (*fakeContainer, bool) {
+	if c, found := s.containers[s0]; found {
+		return c, true
+	}
+
+	name := strings.TrimPrefix(s0, "/")
+	for _, c := range s.containers {
+		if c.Name == name || (len(s0) >= 12 && strings.HasPrefix(c.ID, s0)) {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, a ...interface{}) {
+	writeJSON(w, status, types.ErrorResponse{Message: fmt.Sprintf(format, a...)})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := reAPIVersion.ReplaceAllString(r.URL.Path, "")
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case p == "/_ping":
+		w.Write([]byte("OK"))
+	case p == "/version":
+		writeJSON(w, http.StatusOK, types.Version{
+			Version:    "1.13.1",
+			APIVersion: "1.25",
+			Os:         runtime.GOOS,
+			Arch:       runtime.GOARCH,
+		})
+	case p == "/info":
+		writeJSON(w, http.StatusOK, types.Info{
+			NCPU:            runtime.NumCPU(),
+			MemTotal:        1 << 30,
+			OperatingSystem: "composertest",
+		})
+	case parts[0] == "containers":
+		s.serveContainers(w, r, parts[1:])
+	case parts[0] == "images":
+		s.serveImages(w, r, parts[1:])
+	case p == "/build" && r.Method == "POST":
+		s.serveBuild(w, r)
+	case parts[0] == "networks":
+		s.serveNetworks(w, r, parts[1:])
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) serveContainers(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) < 1:
+		writeError(w, http.StatusNotFound, "page not found")
+		return
+	case parts[0] == "json" && r.Method == "GET":
+		s.listContainers(w, r)
+		return
+	case parts[0] == "create" && r.Method == "POST":
+		s.createContainer(w, r)
+		return
+	}
+
+	c, found := s.findContainer(parts[0])
+	if !found {
+		writeError(w, http.StatusNotFound, "No such container: %s", parts[0])
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != "DELETE" {
+			writeError(w, http.StatusNotFound, "page not found")
+			return
+		}
+
+		if c.State == "running" || c.State == "paused" {
+			if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); !force {
+				writeError(w, http.StatusConflict, "You cannot remove a running container %s. Stop the container before attempting removal or use -f", c.ID)
+				return
+			}
+			s.stop(c, 137)
+		}
+		delete(s.containers, c.ID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch parts[1] {
+	case "json":
+		writeJSON(w, http.StatusOK, inspectContainer(c))
+	case "start":
+		if c.State != "running" && c.State != "paused" {
+			s.start(c)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "stop":
+		s.stop(c, 0)
+		w.WriteHeader(http.StatusNoContent)
+	case "kill":
+		s.stop(c, 137)
+		w.WriteHeader(http.StatusNoContent)
+	case "restart":
+		s.stop(c, 0)
+		s.start(c)
+		w.WriteHeader(http.StatusNoContent)
+	case "pause", "unpause":
+		if c.State != "running" && c.State != "paused" {
+			writeError(w, http.StatusConflict, "Container %s is not running", c.ID)
+			return
+		}
+		c.State = map[string]string{"pause": "paused", "unpause": "running"}[parts[1]]
+		if c.Node != nil {
+			c.Node.setPaused(c.State == "paused")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "wait":
+		writeJSON(w, http.StatusOK, container.ContainerWaitOKBody{StatusCode: int64(c.ExitCode)})
+	case "logs":
+		writeLogs(w, r, c)
+	case "stats":
+		writeJSON(w, http.StatusOK, types.StatsJSON{Stats: types.Stats{Read: time.Now()}})
+	case "archive":
+		s.serveArchive(w, r, c)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) listContainers(w http.ResponseWriter, r *http.Request) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+
+	cl := []types.Container{}
+	for _, c := range s.containers {
+		if !all && c.State != "running" {
+			continue
+		}
+
+		cl = append(cl, types.Container{
+			ID:      c.ID,
+			Names:   []string{"/" + c.Name},
+			Image:   c.Image,
+			ImageID: c.ImageID,
+			Created: c.Created.Unix(),
+			State:   c.State,
+			Status:  c.status(),
+		})
+	}
+	sort.Slice(cl, func(i, j int) bool {
+		return cl[i].Names[0] < cl[j].Names[0]
+	})
+
+	writeJSON(w, http.StatusOK, cl)
+}
+
+func (s *Server) createContainer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		*container.Config
+		HostConfig       *container.HostConfig
+		NetworkingConfig *network.NetworkingConfig
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Config == nil {
+		writeError(w, http.StatusBadRequest, "invalid container config: %v", err)
+		return
+	}
+	if body.HostConfig == nil {
+		body.HostConfig = &container.HostConfig{}
+	}
+
+	name := r.URL.Query().Get("name")
+	if c, found := s.findContainer(name); found && len(name) > 0 {
+		writeError(
+			w,
+			http.StatusConflict,
+			`Conflict. The container name "/%s" is already in use by container "%s". You have to remove (or rename) that container to be able to reuse that name.`,
+			name,
+			c.ID,
+		)
+		return
+	}
+
+	imageID, found := s.findImage(body.Image)
+	if !found {
+		writeError(w, http.StatusNotFound, "No such image: %s", body.Image)
+		return
+	}
+
+	mode := body.HostConfig.NetworkMode
+	if !mode.IsDefault() && !mode.IsHost() && !mode.IsContainer() && !mode.IsNone() {
+		if _, found := s.networks[string(mode)]; !found {
+			writeError(w, http.StatusNotFound, "network %s not found", mode)
+			return
+		}
+	}
+
+	c := &fakeContainer{
+		ID:         s.newID(),
+		Name:       name,
+		Image:      body.Image,
+		ImageID:    imageID,
+		Created:    time.Now(),
+		Config:     body.Config,
+		HostConfig: body.HostConfig,
+		State:      "created",
+		Files:      map[string][]byte{},
+		Dirs:       map[string]bool{},
+	}
+	if len(c.Name) < 1 {
+		c.Name = c.ID[:12]
+	}
+	s.containers[c.ID] = c
+
+	writeJSON(w, http.StatusCreated, container.ContainerCreateCreatedBody{ID: c.ID})
+}
+
+// start runs the container; the sebak container starts the fake node and
+// the others exit at once.
+func (s *Server) start(c *fakeContainer) {
+	c.State = "running"
+	c.ExitCode = 0
+
+	if !c.isSEBAK() {
+		if strings.Contains(strings.Join(c.Config.Entrypoint, " "), "ip route") {
+			c.Logs.WriteString(s.IP + "\n")
+		}
+		c.State = "exited"
+		return
+	}
+
+	nd, err := startNode(net.JoinHostPort(s.IP, nodePort(c)), c.env("SEBAK_NODE_ALIAS"), c.env("SEBAK_SECRET_SEED"))
+	if err != nil {
+		fmt.Fprintf(&c.Logs, "failed to start node: %v\n", err)
+		c.State = "exited"
+		c.ExitCode = 1
+		return
+	}
+	c.Node = nd
+	fmt.Fprintf(&c.Logs, "node started; endpoint=%s\n", c.env("SEBAK_PUBLISH"))
+}
+
+func (s *Server) stop(c *fakeContainer, exitCode int) {
+	if c.State != "running" && c.State != "paused" {
+		return
+	}
+
+	if c.Node != nil {
+		c.Node.Close()
+		c.Node = nil
+	}
+	c.State = "exited"
+	c.ExitCode = exitCode
+}
+
+// nodePort returns the port, which the node is accessed from composer, like
+// `composer.PublishEndpoint`.
+func nodePort(c *fakeContainer) string {
+	port := "0"
+	if i := strings.LastIndex(c.env("SEBAK_PUBLISH"), ":"); i >= 0 {
+		port = strings.TrimRight(c.env("SEBAK_PUBLISH")[i+1:], "/")
+	}
+
+	if c.HostConfig.NetworkMode.IsHost() {
+		return port
+	}
+
+	bindings := c.HostConfig.PortBindings[nat.Port(port+"/tcp")]
+	if len(bindings) > 0 && len(bindings[0].HostPort) > 0 {
+		return bindings[0].HostPort
+	}
+
+	return port
+}
+
+func inspectContainer(c *fakeContainer) types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:      c.ID,
+			Created: c.Created.Format(time.RFC3339Nano),
+			Name:    "/" + c.Name,
+			Image:   c.ImageID,
+			State: &types.ContainerState{
+				Status:   c.State,
+				Running:  c.State == "running" || c.State == "paused",
+				Paused:   c.State == "paused",
+				ExitCode: c.ExitCode,
+			},
+			HostConfig: c.HostConfig,
+		},
+		Config:          c.Config,
+		NetworkSettings: &types.NetworkSettings{},
+	}
+}
+
+// writeLogs writes the logs of container in the multiplexed stream of
+// stdout.
+func writeLogs(w http.ResponseWriter, r *http.Request, c *fakeContainer) {
+	lines := strings.SplitAfter(c.Logs.String(), "\n")
+	if len(lines) > 0 && len(lines[len(lines)-1]) < 1 {
+		lines = lines[:len(lines)-1]
+	}
+	if tail, err := strconv.Atoi(r.URL.Query().Get("tail")); err == nil && tail >= 0 && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+	w.WriteHeader(http.StatusOK)
+	for _, l := range lines {
+		header := make([]byte, 8)
+		header[0] = 1
+		binary.BigEndian.PutUint32(header[4:], uint32(len(l)))
+		w.Write(header)
+		w.Write([]byte(l))
+	}
+}
+
+func (s *Server) serveArchive(w http.ResponseWriter, r *http.Request, c *fakeContainer) {
+	p := path.Clean("/" + r.URL.Query().Get("path"))
+
+	_, isFile := c.Files[p]
+	isDir := p == "/" || c.Dirs[p]
+
+	switch r.Method {
+	case "HEAD", "GET":
+		if !isFile && !isDir {
+			writeError(w, http.StatusNotFound, "Could not find the file %s in container %s", p, c.Name)
+			return
+		}
+
+		stat := types.ContainerPathStat{Name: path.Base(p), Size: int64(len(c.Files[p])), Mode: 0644, Mtime: c.Created}
+		if isDir {
+			stat.Mode = os.ModeDir | 0755
+		}
+		b, _ := json.Marshal(stat)
+		w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(b))
+
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.WriteHeader(http.StatusOK)
+		writeArchive(w, c, p, isDir)
+	case "PUT":
+		if !isDir {
+			writeError(w, http.StatusNotFound, "Could not find the file %s in container %s", p, c.Name)
+			return
+		}
+
+		tr := tar.NewReader(r.Body)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid archive: %v", err)
+				return
+			}
+
+			target := path.Join(p, path.Clean("/"+hdr.Name))
+			switch hdr.Typeflag {
+			case tar.TypeDir:
+				c.Dirs[target] = true
+			case tar.TypeReg, tar.TypeRegA:
+				b, _ := ioutil.ReadAll(tr)
+				writeFile(c, target, b)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+// writeArchive writes the file or the directory into tar archive; the
+// entries are relative to the parent of `p`, like docker.
+func writeArchive(w io.Writer, c *fakeContainer, p string, isDir bool) {
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	base := path.Dir(p)
+	rel := func(s string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(s, base), "/")
+	}
+
+	if !isDir {
+		tw.WriteHeader(&tar.Header{Name: path.Base(p), Mode: 0644, Size: int64(len(c.Files[p])), ModTime: c.Created})
+		tw.Write(c.Files[p])
+		return
+	}
+
+	var dirs, files []string
+	for d := range c.Dirs {
+		if d == p || strings.HasPrefix(d, p+"/") || p == "/" {
+			dirs = append(dirs, d)
+		}
+	}
+	for f := range c.Files {
+		if strings.HasPrefix(f, p+"/") || p == "/" {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(dirs)
+	sort.Strings(files)
+
+	if p != "/" && !c.Dirs[p] {
+		dirs = append([]string{p}, dirs...)
+	}
+	for _, d := range dirs {
+		tw.WriteHeader(&tar.Header{Name: rel(d) + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: c.Created})
+	}
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: rel(f), Mode: 0644, Size: int64(len(c.Files[f])), ModTime: c.Created})
+		tw.Write(c.Files[f])
+	}
+}
+
+func (s *Server) serveImages(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 1 && parts[0] == "json" && r.Method == "GET":
+		var ids []string
+		for id := range s.images {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		images := []types.ImageSummary{}
+		for _, id := range ids {
+			images = append(images, types.ImageSummary{ID: id, RepoTags: s.images[id], Created: time.Now().Unix()})
+		}
+		writeJSON(w, http.StatusOK, images)
+	case len(parts) == 1 && parts[0] == "create" && r.Method == "POST":
+		ref := r.URL.Query().Get("fromImage")
+		ref = strings.TrimPrefix(strings.TrimPrefix(ref, "docker.io/"), "library/")
+		if tag := r.URL.Query().Get("tag"); len(tag) > 0 {
+			ref = ref + ":" + tag
+		}
+		s.addImage(ref)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "Status: Downloaded newer image for " + ref})
+	case len(parts) >= 1 && r.Method == "DELETE":
+		ref := strings.Join(parts, "/")
+		id, found := s.findImage(ref)
+		if !found {
+			writeError(w, http.StatusNotFound, "No such image: %s", ref)
+			return
+		}
+		delete(s.images, id)
+		writeJSON(w, http.StatusOK, []types.ImageDelete{{Deleted: id}})
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) serveBuild(w http.ResponseWriter, r *http.Request) {
+	io.Copy(ioutil.Discard, r.Body)
+
+	var id string
+	for _, t := range r.URL.Query()["t"] {
+		id = s.addImage(t)
+	}
+	if len(id) < 1 {
+		id = "sha256:" + s.newID()
+		s.images[id] = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"stream": "Successfully built " + id + "\n"})
+}
+
+func (s *Server) serveNetworks(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 1 && parts[0] == "create" && r.Method == "POST":
+		var body types.NetworkCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid network config: %v", err)
+			return
+		}
+		if _, found := s.networks[body.Name]; found {
+			writeError(w, http.StatusConflict, "network with name %s already exists", body.Name)
+			return
+		}
+
+		n := types.NetworkResource{
+			Name:       body.Name,
+			ID:         s.newID(),
+			Driver:     body.Driver,
+			Attachable: body.Attachable,
+		}
+		if body.IPAM != nil {
+			n.IPAM = *body.IPAM
+		}
+		s.networks[n.Name] = n
+
+		writeJSON(w, http.StatusCreated, types.NetworkCreateResponse{ID: n.ID})
+	case len(parts) == 1 && (r.Method == "GET" || r.Method == "DELETE"):
+		var n types.NetworkResource
+		var found bool
+		for _, i := range s.networks {
+			if i.Name == parts[0] || i.ID == parts[0] {
+				n, found = i, true
+				break
+			}
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "network %s not found", parts[0])
+			return
+		}
+
+		if r.Method == "GET" {
+			writeJSON(w, http.StatusOK, n)
+			return
+		}
+		delete(s.networks, n.Name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
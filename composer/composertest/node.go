@@ -0,0 +1,135 @@
+package composertest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"boscoin.io/sebak/lib/common/keypair"
+
+	"github.com/spikeekips/sebak-network-composer/composer"
+)
+
+// Node is the fake SEBAK node; it serves the node info and the block API
+// with the block, which is set by `SetBlock`.
+type Node struct {
+	lock    sync.RWMutex
+	srv     *httptest.Server
+	alias   string
+	address string
+	height  uint64
+	hash    string
+	paused  bool
+}
+
+func startNode(addr, alias, seed string) (nd *Node, err error) {
+	var l net.Listener
+	if l, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+
+	nd = &Node{alias: alias}
+	if kp, e := keypair.Parse(seed); e == nil {
+		nd.address = kp.Address()
+	}
+	nd.SetBlock(1, "")
+
+	nd.srv = httptest.NewUnstartedServer(nd)
+	nd.srv.Listener.Close()
+	nd.srv.Listener = l
+	nd.srv.StartTLS()
+
+	return
+}
+
+// blockHash returns the hash of the height; the nodes of same height agree.
+func blockHash(height uint64) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strconv.FormatUint(height, 10))))[:44]
+}
+
+// SetBlock sets the latest block; if the hash is empty, it is derived from the
+// height.
+func (nd *Node) SetBlock(height uint64, hash string) {
+	nd.lock.Lock()
+	defer nd.lock.Unlock()
+
+	if len(hash) < 1 {
+		hash = blockHash(height)
+	}
+	nd.height, nd.hash = height, hash
+}
+
+func (nd *Node) setPaused(paused bool) {
+	nd.lock.Lock()
+	defer nd.lock.Unlock()
+
+	nd.paused = paused
+}
+
+// Close stops the node.
+func (nd *Node) Close() {
+	nd.srv.Close()
+}
+
+func (nd *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	nd.lock.RLock()
+	defer nd.lock.RUnlock()
+
+	if nd.paused {
+		// the paused node does not respond
+		writeError(w, http.StatusServiceUnavailable, "node is paused")
+		return
+	}
+
+	switch p := strings.TrimRight(r.URL.Path, "/"); {
+	case p == "":
+		var info composer.NodeInfo
+		info.Node.State = "CONSENSUS"
+		info.Node.Alias = nd.alias
+		info.Node.Address = nd.address
+		info.Node.Endpoint = "https://" + r.Host
+		info.Node.Version.Version = "composertest"
+		info.Block.Height = nd.height
+		info.Block.Hash = nd.hash
+		writeJSON(w, http.StatusOK, info)
+	case strings.HasPrefix(p, "/api/v1/blocks/"):
+		key := strings.TrimPrefix(p, "/api/v1/blocks/")
+		height, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			for h := uint64(1); h <= nd.height; h++ {
+				if nd.blockHashOf(h) == key {
+					height, err = h, nil
+					break
+				}
+			}
+		}
+		if err != nil || height < 1 || height > nd.height {
+			writeError(w, http.StatusNotFound, "block not found")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"hash":         nd.blockHashOf(height),
+			"height":       height,
+			"proposer":     nd.address,
+			"round":        0,
+			"transactions": []string{},
+			"confirmed":    "",
+		})
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (nd *Node) blockHashOf(height uint64) string {
+	if height == nd.height {
+		return nd.hash
+	}
+
+	return blockHash(height)
+}
@@ -0,0 +1,477 @@
+package composer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+
+	"boscoin.io/sebak/lib/common/keypair"
+	"boscoin.io/sebak/lib/node"
+)
+
+type Volume struct {
+	Source string
+	Target string
+}
+
+func (v *Volume) UnmarshalText(b []byte) error {
+	a := strings.SplitN(string(b), ":", 2)
+	if len(a) != 2 {
+		return fmt.Errorf("invalid volume: '%v'", string(b))
+	}
+
+	v.Source = a[0]
+	v.Target = a[1]
+
+	return nil
+}
+
+type DockerHost struct {
+	Host          string               `toml:"host"`
+	Ca            string               `toml:"ca"`
+	Cert          string               `toml:"cert"`
+	CertKey       string               `toml:"cert_key"`
+	Volume        []Volume             `toml:"volume"`
+	Env           []string             `toml:"env"`
+	Seeds         []string             `toml:"seeds"`
+	Resources     Resources            `toml:"resources"`
+	NodeResources map[string]Resources `toml:"node-resources"`
+	Retry         Retry                `toml:"retry"`
+
+	client       *client.Client
+	Name         string
+	IP           string
+	Nodes        []*node.LocalNode
+	NodeNetworks map[string]NodeNetwork
+	Keys         []*keypair.Full
+}
+
+// validate checks the connection settings of docker host without connecting
+// to it.
+func (dh *DockerHost) validate() (err error) {
+	var u *url.URL
+	if u, err = url.Parse(dh.Host); err != nil {
+		return
+	}
+
+	if len(dh.Ca) < 1 {
+		err = fmt.Errorf("`ca` is missing")
+		return
+	}
+
+	if len(dh.Cert) < 1 {
+		err = fmt.Errorf("`cert` is missing")
+		return
+	}
+
+	if len(dh.CertKey) < 1 {
+		err = fmt.Errorf("`cert_key` is missing")
+		return
+	}
+
+	dh.Ca = patchHomeDir(dh.Ca)
+	dh.Cert = patchHomeDir(dh.Cert)
+	dh.CertKey = patchHomeDir(dh.CertKey)
+
+	u.RawQuery = ""
+	dh.Host = u.String()
+
+	return nil
+}
+
+func (dh *DockerHost) newClient() (cl *client.Client, err error) {
+	options := tlsconfig.Options{
+		CAFile:             dh.Ca,
+		CertFile:           dh.Cert,
+		KeyFile:            dh.CertKey,
+		InsecureSkipVerify: os.Getenv("DOCKER_TLS_VERIFY") == "",
+	}
+
+	var tlsc *tls.Config
+	if tlsc, err = tlsconfig.Client(options); err != nil {
+		return
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: tlsc,
+	}
+	c := &http.Client{Transport: transport}
+
+	if cl, err = client.NewClient(dh.Host, "", c, nil); err != nil {
+		return
+	}
+
+	// docker client checks the tls config of `*http.Transport` only when it is
+	// created, so the transport is wrapped after.
+	c.Transport = recordTransport{transport}
+
+	return
+}
+
+// Connect checks the docker host is reachable; each probe is limited by the
+// timeout and the probes are retried by the retry policy of host. The failed
+// host can be connected again.
+func (dh *DockerHost) Connect(ctx context.Context, timeout time.Duration) error {
+	if dh.client == nil {
+		return fmt.Errorf("host, '%s': docker client is not created; load the host by LoadConfig", dh.Name)
+	}
+
+	opts := Options{DockerTimeout: timeout}
+	err := dh.Retry.Do(ctx, func(ctx context.Context) error {
+		c, cancel := opts.dockerContext(ctx)
+		defer cancel()
+
+		_, err := dh.client.ContainerList(c, types.ContainerListOptions{All: true})
+		return err
+	})
+	if err != nil {
+		return &HostUnreachableError{Host: dh.Name, Err: err}
+	}
+
+	return nil
+}
+
+// Client returns the docker client; the docker host should be connected by
+// `Connect` first, so the unreachable host is reported as
+// `HostUnreachableError` instead of failing every docker call.
+func (dh *DockerHost) Client() *client.Client {
+	return dh.client
+}
+
+// ConnectHosts connects to the docker hosts concurrently; the probes share the
+// timeout. The errors are returned in the order of hosts.
+func ConnectHosts(ctx context.Context, hosts []*DockerHost, timeout time.Duration) []error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	errs := make([]error, len(hosts))
+
+	var wg sync.WaitGroup
+	wg.Add(len(hosts))
+	for i, dh := range hosts {
+		go func(i int, dh *DockerHost) {
+			defer wg.Done()
+			errs[i] = dh.Connect(ctx, timeout)
+		}(i, dh)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+type Config struct {
+	Genesis     string                `toml:"genesis"`
+	GenesisSeed GenesisSeed           `toml:"genesis-seed"`
+	Common      string                `toml:"common"`
+	DockerPath  string                `toml:"docker-path"`
+	Resources   Resources             `toml:"resources"`
+	Retry       Retry                 `toml:"retry"`
+	Network     NetworkConfig         `toml:"network"`
+	Hosts       map[string]DockerHost `toml:"hosts"`
+	DockerHosts []*DockerHost
+	Unreachable []UnreachableHost
+	dockerHosts map[string]*DockerHost
+	path        string
+
+	genesisKeypair *keypair.Full
+}
+
+// UnreachableHost is the docker host, which is skipped by `Connect`.
+type UnreachableHost struct {
+	Name  string
+	Host  string
+	Error error
+}
+
+// ConnectOptions is the options of `Config.Connect`.
+type ConnectOptions struct {
+	// Timeout is shared by the probes of all hosts.
+	Timeout time.Duration
+	// SkipUnreachable removes the unreachable hosts from config instead of
+	// failing; they are kept in `Config.Unreachable`.
+	SkipUnreachable bool
+}
+
+// Connect connects to all the docker hosts concurrently. With
+// `SkipUnreachable`, the unreachable hosts are removed from config, otherwise
+// any unreachable host is error.
+func (c *Config) Connect(ctx context.Context, opts ConnectOptions) error {
+	errs := ConnectHosts(ctx, c.DockerHosts, opts.Timeout)
+
+	var reachable []*DockerHost
+	var failed MultiError
+	for i, dh := range c.DockerHosts {
+		err := errs[i]
+		switch {
+		case err == nil:
+			reachable = append(reachable, dh)
+		case opts.SkipUnreachable:
+			c.Unreachable = append(c.Unreachable, UnreachableHost{Name: dh.Name, Host: dh.Host, Error: err})
+			delete(c.dockerHosts, dh.Host)
+		default:
+			failed.Append(err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	if len(c.DockerHosts) > 0 && len(reachable) < 1 {
+		// all the hosts are skipped
+		var errs MultiError
+		for _, u := range c.Unreachable {
+			errs.Append(u.Error)
+		}
+		return errs
+	}
+	c.DockerHosts = reachable
+
+	return nil
+}
+
+// Path returns the path of config file.
+func (c *Config) Path() string {
+	return c.path
+}
+
+func (c *Config) GetDockerHost(host string) (dh *DockerHost, found bool) {
+	dh, found = c.dockerHosts[host]
+	return
+}
+
+// GenesisKeypair returns the keypair of genesis account; it is available
+// only when `genesis-seed` is set in config. The genesis account, which is
+// created by `LoadOptions.CreateGenesis` is not returned, because the running
+// network may have the other genesis account.
+func (c *Config) GenesisKeypair() (*keypair.Full, error) {
+	if c.genesisKeypair == nil {
+		return nil, fmt.Errorf("genesis seed is not set in config")
+	}
+
+	return c.genesisKeypair, nil
+}
+
+// GenesisSeed is the source of genesis seed; only one of them can be set.
+type GenesisSeed struct {
+	Seed string `toml:"seed"`
+	File string `toml:"file"`
+	Env  string `toml:"env"`
+}
+
+// Load reads the seed from the source; the relative file path is based on the
+// directory of config file. If no source is set, nil is returned.
+func (g GenesisSeed) Load(base string) (kp *keypair.Full, err error) {
+	var sources int
+	for _, v := range []string{g.Seed, g.File, g.Env} {
+		if len(v) > 0 {
+			sources++
+		}
+	}
+	if sources < 1 {
+		return
+	} else if sources > 1 {
+		err = fmt.Errorf("only one of seed, file and env can be set")
+		return
+	}
+
+	seed := g.Seed
+	switch {
+	case len(g.File) > 0:
+		p := patchHomeDir(g.File)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(base), p)
+		}
+
+		var b []byte
+		if b, err = ioutil.ReadFile(p); err != nil {
+			return
+		}
+		seed = strings.TrimSpace(string(b))
+	case len(g.Env) > 0:
+		if seed = os.Getenv(g.Env); len(seed) < 1 {
+			err = fmt.Errorf("environment variable, '%s' is empty", g.Env)
+			return
+		}
+	}
+
+	return parseSeed(seed)
+}
+
+func parseSeed(s string) (full *keypair.Full, err error) {
+	var kp keypair.KP
+	if kp, err = keypair.Parse(s); err != nil {
+		return
+	}
+
+	var ok bool
+	if full, ok = kp.(*keypair.Full); !ok {
+		err = fmt.Errorf("public address found")
+	}
+
+	return
+}
+
+// LoadOptions is the options of `LoadConfig`.
+type LoadOptions struct {
+	// Output receives the seeds of the genesis and common accounts, which are
+	// created when they are not set in config; by default, they are not
+	// printed.
+	Output io.Writer
+	// CreateGenesis creates the random genesis account if neither `genesis`
+	// nor `genesis-seed` is set in config; it is only for deploying the new
+	// network, so the created keypair is not returned by `GenesisKeypair`.
+	CreateGenesis bool
+}
+
+// LoadConfig reads and validates the config file; the docker clients are
+// created, but the docker hosts are not connected until `Connect`.
+func LoadConfig(f string, opts LoadOptions) (conf *Config, err error) {
+	output := opts.Output
+	if output == nil {
+		output = ioutil.Discard
+	}
+
+	var i *os.File
+	if i, err = os.Open(f); err != nil {
+		return
+	}
+	defer i.Close()
+
+	var b []byte
+	if b, err = ioutil.ReadAll(i); err != nil {
+		return
+	}
+
+	if _, err = toml.Decode(string(b), &conf); err != nil {
+		return
+	}
+	conf.path = f
+
+	if err = conf.Resources.Validate(); err != nil {
+		return
+	}
+
+	if err = conf.Network.Validate(); err != nil {
+		return
+	}
+
+	conf.Retry = DefaultRetry().Merge(conf.Retry)
+	if err = conf.Retry.Validate(); err != nil {
+		return
+	}
+
+	m := map[string]*DockerHost{}
+	var hosts []string
+	for name, h := range conf.Hosts {
+		if err = conf.Resources.Merge(h.Resources).Validate(); err != nil {
+			err = fmt.Errorf("host, '%s': %v", name, err)
+			return
+		}
+		for k, r := range h.NodeResources {
+			if err = conf.Resources.Merge(h.Resources).Merge(r).Validate(); err != nil {
+				err = fmt.Errorf("host, '%s', node, '%s': %v", name, k, err)
+				return
+			}
+		}
+
+		retry := conf.Retry.Merge(h.Retry)
+		if err = retry.Validate(); err != nil {
+			err = fmt.Errorf("host, '%s': %v", name, err)
+			return
+		}
+
+		var keys []*keypair.Full
+		for _, s := range h.Seeds {
+			var full *keypair.Full
+			if full, err = parseSeed(s); err != nil {
+				return
+			}
+			keys = append(keys, full)
+		}
+
+		dh := &DockerHost{
+			Name:    name,
+			Host:    h.Host,
+			Ca:      h.Ca,
+			Cert:    h.Cert,
+			CertKey: h.CertKey,
+			Volume:  h.Volume,
+			Env:     h.Env,
+			Keys:    keys,
+
+			NodeNetworks:  map[string]NodeNetwork{},
+			Resources:     h.Resources,
+			NodeResources: h.NodeResources,
+			Retry:         retry,
+		}
+		if err = dh.validate(); err != nil {
+			err = fmt.Errorf("host, '%s': %v", name, err)
+			return
+		}
+		if dh.client, err = dh.newClient(); err != nil {
+			err = fmt.Errorf("host, '%s': %v", name, err)
+			return
+		}
+
+		m[dh.Host] = dh
+		hosts = append(hosts, dh.Host)
+	}
+
+	sort.Strings(hosts)
+	for _, k := range hosts {
+		conf.DockerHosts = append(conf.DockerHosts, m[k])
+	}
+
+	conf.dockerHosts = m
+
+	if conf.genesisKeypair, err = conf.GenesisSeed.Load(f); err != nil {
+		err = fmt.Errorf("genesis-seed: %v", err)
+		return
+	}
+
+	if len(conf.Genesis) < 1 && conf.genesisKeypair != nil {
+		conf.Genesis = conf.genesisKeypair.Address()
+	} else if len(conf.Genesis) < 1 && opts.CreateGenesis {
+		kp := keypair.Random()
+		conf.Genesis = kp.Address()
+		fmt.Fprintln(output, "genesis keypair created", "seed", kp.Seed(), "address", kp.Address())
+	} else if conf.genesisKeypair != nil && conf.genesisKeypair.Address() != conf.Genesis {
+		err = fmt.Errorf("genesis-seed: does not match with genesis, '%s'", conf.Genesis)
+		return
+	}
+	if len(conf.Common) < 1 {
+		kp := keypair.Random()
+		conf.Common = kp.Address()
+		fmt.Fprintln(output, "common keypair created", "seed", kp.Seed(), "address", kp.Address())
+	}
+
+	return
+}
+
+func patchHomeDir(s string) string {
+	if !strings.HasPrefix(s, "~") {
+		return s
+	}
+
+	u, _ := user.Current()
+	return filepath.Join(u.HomeDir, s[2:])
+}
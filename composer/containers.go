@@ -0,0 +1,205 @@
+package composer
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+)
+
+// hostContainer is the node container of docker host.
+type hostContainer struct {
+	Host      *DockerHost
+	Container types.Container
+}
+
+// Name returns the container name.
+func (c hostContainer) Name() string {
+	return ContainerShortName(c.Container.Names)
+}
+
+// nodeContainers returns the node containers of the hosts, which match with
+// the node selectors; the selector, which matches no container is error. Only
+// the hosts of the selected nodes are used; see `Config.SelectHosts`.
+func nodeContainers(ctx context.Context, conf *Config, nodes []string, opts Options) (containers []hostContainer, err error) {
+	m := NewNodeMatcher(nodes)
+	for _, dh := range conf.SelectHosts(nodes) {
+		var cl []types.Container
+		if cl, err = Containers(ctx, dh, opts); err != nil {
+			err = &HostUnreachableError{Host: dh.Name, Err: err}
+			return
+		}
+
+		for _, c := range cl {
+			if m.Match(dh, ContainerShortName(c.Names)) {
+				containers = append(containers, hostContainer{Host: dh, Container: c})
+			}
+		}
+	}
+
+	err = m.Err()
+
+	return
+}
+
+// eachContainer runs f for the containers concurrently and returns the names
+// of the containers, which succeeded.
+func eachContainer(containers []hostContainer, f func(hostContainer) error) (names []string, err error) {
+	var errs MultiError
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(containers))
+	for _, c := range containers {
+		go func(c hostContainer) {
+			defer wg.Done()
+
+			e := f(c)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if e != nil {
+				errs.Append(e)
+				return
+			}
+			names = append(names, c.Name())
+		}(c)
+	}
+	wg.Wait()
+
+	return names, errs.ErrorOrNil()
+}
+
+// LogsOptions is the options of `Logs`.
+type LogsOptions struct {
+	Options
+	// Nodes selects the node containers by host name, container name, node
+	// alias or node address; by default, all the node containers. The
+	// selector, which matches no container is error.
+	Nodes []string
+	// Since and Tail are same with the options of `docker logs`.
+	Since string
+	Tail  string
+}
+
+// Logs saves the logs of the node containers into `<dir>/<container>.log`
+// and returns the saved container names.
+func Logs(ctx context.Context, conf *Config, dir string, opts LogsOptions) (names []string, err error) {
+	var containers []hostContainer
+	if containers, err = nodeContainers(ctx, conf, opts.Nodes, opts.Options); err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	return eachContainer(containers, func(c hostContainer) error {
+		return saveContainerLogs(ctx, c.Host, c.Container.ID, filepath.Join(dir, c.Name()+".log"), opts)
+	})
+}
+
+func saveContainerLogs(ctx context.Context, dh *DockerHost, id, path string, opts LogsOptions) (err error) {
+	reader, err := dh.client.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      opts.Since,
+		Tail:       opts.Tail,
+	})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	output, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// the log file is closed on every path; the close error is returned,
+	// because the buffered logs can be lost.
+	defer func() {
+		if e := output.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		b := scanner.Bytes()
+		if len(b) < 8 {
+			b = []byte{}
+		} else {
+			b = b[8:]
+		}
+		if _, err = output.Write(append(b, []byte("\n")...)); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// StopOptions is the options of `Stop`.
+type StopOptions struct {
+	Options
+	// Nodes selects the node containers; see `LogsOptions.Nodes`.
+	Nodes []string
+}
+
+// Stop stops the node containers and returns the stopped container names.
+func Stop(ctx context.Context, conf *Config, opts StopOptions) (names []string, err error) {
+	var containers []hostContainer
+	if containers, err = nodeContainers(ctx, conf, opts.Nodes, opts.Options); err != nil {
+		return
+	}
+
+	return eachContainer(containers, func(c hostContainer) error {
+		dctx, cancel := opts.dockerContext(ctx)
+		defer cancel()
+
+		if err := c.Host.client.ContainerStop(dctx, c.Container.ID, nil); err != nil {
+			opts.logger().Error("failed to stop", "container", c.Name(), "error", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// RemoveOptions is the options of `Remove`.
+type RemoveOptions struct {
+	Options
+	// Nodes selects the node containers; see `LogsOptions.Nodes`. If not
+	// set, the docker network of nodes is also removed.
+	Nodes []string
+}
+
+// Remove removes the node containers and returns the removed container
+// names.
+func Remove(ctx context.Context, conf *Config, opts RemoveOptions) (names []string, err error) {
+	var containers []hostContainer
+	if containers, err = nodeContainers(ctx, conf, opts.Nodes, opts.Options); err != nil {
+		return
+	}
+
+	names, err = eachContainer(containers, func(c hostContainer) error {
+		return RemoveContainer(ctx, c.Host, c.Container.ID, opts.Options)
+	})
+
+	if len(opts.Nodes) > 0 || conf.Network.IsHost() {
+		return
+	}
+
+	errs := MultiError{}
+	errs.Append(err)
+	for _, dh := range conf.DockerHosts {
+		if e := removeNetwork(ctx, dh.client, conf.Network, opts.Options); e != nil {
+			opts.logger().Error("failed to remove network", "host", dh.Name, "network", conf.Network.Name, "error", e)
+			errs.Append(e)
+		}
+	}
+
+	return names, errs.ErrorOrNil()
+}
@@ -0,0 +1,333 @@
+package composer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/node"
+	"github.com/docker/docker/api/types"
+)
+
+// DeployOptions is the options of `Deploy`.
+type DeployOptions struct {
+	Options
+	// Image is the sebak image of nodes; by default, `DefaultImage`.
+	Image string
+	// SebakLogLevel is the log level of nodes; by default,
+	// `DefaultSebakLogLevel`.
+	SebakLogLevel string
+	// Force removes the existing node containers before deploying.
+	Force bool
+	// ReadinessWait is how long the node containers are watched after they
+	// are started; by default, 5 seconds.
+	ReadinessWait time.Duration
+}
+
+func (o DeployOptions) image() string {
+	if len(o.Image) > 0 {
+		return o.Image
+	}
+
+	return DefaultImage
+}
+
+func (o DeployOptions) sebakLogLevel() string {
+	if len(o.SebakLogLevel) > 0 {
+		return o.SebakLogLevel
+	}
+
+	return DefaultSebakLogLevel
+}
+
+func (o DeployOptions) readinessWait() time.Duration {
+	if o.ReadinessWait > 0 {
+		return o.ReadinessWait
+	}
+
+	return time.Second * 5
+}
+
+// Deployment is the result of `Deploy`.
+type Deployment struct {
+	// Nodes is the composed nodes by address.
+	Nodes map[string]*node.LocalNode
+	// Containers is the last state of node containers by container name.
+	Containers map[string]types.Container
+	// Created is the ids of the created containers by docker host.
+	Created map[*DockerHost][]string
+}
+
+// Compose gets the internal ip of the docker hosts and composes the nodes of
+// the keys of hosts; every node has the other nodes as validators. The nodes
+// are kept in `DockerHost.Nodes`, so `Deploy` should be called with the same
+// config. The config, which skipped the unreachable hosts, can not be
+// composed, because the nodes of the skipped hosts would be missing.
+func Compose(ctx context.Context, conf *Config, opts Options) (nodes map[string]*node.LocalNode, err error) {
+	if len(conf.Genesis) < 1 {
+		err = fmt.Errorf("failed to compose network: genesis is not set; set genesis or genesis-seed in config, or load config with CreateGenesis")
+		return
+	}
+
+	if len(conf.Unreachable) > 0 {
+		var names []string
+		for _, u := range conf.Unreachable {
+			names = append(names, u.Name)
+		}
+		err = fmt.Errorf("failed to compose network: unreachable hosts are skipped, %q", names)
+		return
+	}
+
+	if err = prepareHostIPs(ctx, conf.DockerHosts, opts); err != nil {
+		return
+	}
+
+	if nodes, err = composeNetwork(conf, opts); err != nil {
+		err = fmt.Errorf("failed to compose network: %v", err)
+	}
+
+	return
+}
+
+// prepareHostIPs gets the internal ip of the hosts concurrently.
+func prepareHostIPs(ctx context.Context, hosts []*DockerHost, opts Options) error {
+	opts.logger().Debug("trying to get internal IP")
+
+	var errs MultiError
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(len(hosts))
+	for _, dh := range hosts {
+		go func(d *DockerHost) {
+			defer wg.Done()
+
+			ip, err := hostIP(ctx, d, opts)
+			if err != nil {
+				lock.Lock()
+				errs.Append(fmt.Errorf("host, '%s': failed to get internal IP: %v", d.Name, err))
+				lock.Unlock()
+				return
+			}
+			d.IP = ip
+		}(dh)
+	}
+	wg.Wait()
+
+	return errs.ErrorOrNil()
+}
+
+func composeNetwork(conf *Config, opts Options) (nodes map[string]*node.LocalNode, err error) {
+	log := opts.logger()
+
+	var numberOfNodes int
+	for _, dh := range conf.DockerHosts {
+		numberOfNodes += len(dh.Keys)
+	}
+
+	log.Debug("trying to compose network", "number of nodes", numberOfNodes)
+
+	nodes = map[string]*node.LocalNode{}
+	var index int
+	for _, dh := range conf.DockerHosts {
+		dh.Nodes = nil
+
+		var port int = BaseContainerPort
+		for i, kp := range dh.Keys {
+			nn := NodeNetwork{IP: dh.IP, HostPort: port}
+			endpointHost := fmt.Sprintf("%s:%d", dh.IP, port)
+
+			switch conf.Network.Mode {
+			case NetworkModeBridge:
+				// the bridge network of each host is independent
+				var ip string
+				if ip, err = conf.Network.NodeIP(i); err != nil {
+					return
+				}
+				nn.IP = ip
+			case NetworkModeOverlay:
+				var ip string
+				if ip, err = conf.Network.NodeIP(index); err != nil {
+					return
+				}
+				nn.IP = ip
+				endpointHost = fmt.Sprintf("%s:%d", ip, BasePort)
+			}
+			dh.NodeNetworks[kp.Address()] = nn
+			index++
+
+			var endpoint *common.Endpoint
+			if endpoint, err = common.NewEndpointFromString(fmt.Sprintf("https://%s", endpointHost)); err != nil {
+				return
+			}
+
+			var nd *node.LocalNode
+			if nd, err = node.NewLocalNode(kp, endpoint, ""); err != nil {
+				return
+			}
+			dh.Nodes = append(dh.Nodes, nd)
+			nodes[kp.Address()] = nd
+
+			log.Debug(
+				"generate node",
+				"address", node.MakeAlias(kp.Address()),
+				"secret-seed", kp.Seed(),
+				"endpoint", endpoint,
+				"ip", nn.IP,
+				"host-port", nn.HostPort,
+			)
+
+			port += 1
+		}
+	}
+
+	log.Debug("generate nodes", "nodes", len(nodes))
+
+	for a0, n0 := range nodes {
+		for a1, n1 := range nodes {
+			if a0 == a1 {
+				continue
+			}
+			n0.AddValidators(n1.ConvertToValidator())
+		}
+	}
+
+	return
+}
+
+// Deploy runs the composed nodes and watches them during the readiness wait.
+// If any node fails to run or the context is canceled, the created containers
+// are removed. The exited or missing node containers are returned as
+// `NodeUnhealthyError`, together with the deployment.
+func Deploy(ctx context.Context, conf *Config, opts DeployOptions) (deployment *Deployment, err error) {
+	deployment = &Deployment{Nodes: map[string]*node.LocalNode{}}
+	for _, dh := range conf.DockerHosts {
+		for _, nd := range dh.Nodes {
+			deployment.Nodes[nd.Address()] = nd
+		}
+	}
+
+	if opts.Force {
+		var errs MultiError
+		for _, dh := range conf.DockerHosts {
+			if e := cleanHost(ctx, dh, opts.Options); e != nil {
+				errs.Append(fmt.Errorf("host, '%s': failed to clean containers: %v", dh.Name, e))
+			}
+		}
+		if err = errs.ErrorOrNil(); err != nil {
+			return
+		}
+	}
+
+	if err = prepareNetworks(ctx, conf.DockerHosts, conf.Network, opts.Options); err != nil {
+		err = fmt.Errorf("failed to prepare network: %v", err)
+		return
+	}
+
+	deployment.Created, err = runNodes(ctx, conf, opts)
+	if err != nil {
+		// the partially deployed network is not left behind
+		removeCreated(deployment.Created, opts.Options)
+		return
+	}
+
+	deployment.Containers, err = waitReadiness(ctx, conf.DockerHosts, opts)
+	if ctx.Err() != nil {
+		removeCreated(deployment.Created, opts.Options)
+		err = ctx.Err()
+	}
+
+	return
+}
+
+// runNodes runs the node containers of the hosts; the created containers are
+// returned with the aggregated errors, so they can be removed.
+func runNodes(ctx context.Context, conf *Config, opts DeployOptions) (created map[*DockerHost][]string, err error) {
+	created = map[*DockerHost][]string{}
+
+	var errs MultiError
+	for _, dh := range conf.DockerHosts {
+		for _, nd := range dh.Nodes {
+			if ctx.Err() != nil {
+				errs.Append(ctx.Err())
+				return created, errs
+			}
+
+			id, e := runNode(ctx, conf, dh, nd, opts)
+			if len(id) > 0 {
+				created[dh] = append(created[dh], id)
+			}
+			if e != nil {
+				errs.Append(e)
+			}
+		}
+	}
+
+	return created, errs.ErrorOrNil()
+}
+
+// waitReadiness watches the node containers during the wait and returns the
+// last container info; the exited or missing containers are NodeUnhealthyError.
+func waitReadiness(ctx context.Context, hosts []*DockerHost, opts DeployOptions) (infos map[string]types.Container, err error) {
+	log := opts.logger()
+
+	infos = map[string]types.Container{}
+	failed := map[string]error{}
+
+	end := time.Now().Add(opts.readinessWait())
+	for {
+		for _, dh := range hosts {
+			for _, nd := range dh.Nodes {
+				name := ContainerName(nd)
+				if info, ok := infos[name]; ok && info.State == "exited" {
+					continue
+				}
+
+				info, e := FindContainer(ctx, dh, name, opts.Options)
+				if e != nil {
+					failed[name] = fmt.Errorf("host, '%s': %v", dh.Name, e)
+					continue
+				}
+				delete(failed, name)
+				if len(info.ID) < 1 {
+					continue
+				}
+				log.Debug("container state", "container", name, "state", info.State, "status", info.Status)
+				infos[name] = info
+			}
+		}
+
+		if time.Now().After(end) || !sleep(ctx, time.Second) {
+			break
+		}
+	}
+
+	var errs MultiError
+	for _, dh := range hosts {
+		for _, nd := range dh.Nodes {
+			name := ContainerName(nd)
+			info, found := infos[name]
+			switch {
+			case failed[name] != nil:
+				errs.Append(failed[name])
+			case !found:
+				errs.Append(&NodeUnhealthyError{Node: name, Reason: "container not found"})
+			case info.State == "exited":
+				errs.Append(&NodeUnhealthyError{Node: name, Reason: fmt.Sprintf("container exited; %s", info.Status)})
+			}
+		}
+	}
+
+	return infos, errs.ErrorOrNil()
+}
+
+// removeCreated removes the created containers after the deploy fails or is
+// canceled; it does not use the canceled context.
+func removeCreated(created map[*DockerHost][]string, opts Options) {
+	for dh, ids := range created {
+		for _, id := range ids {
+			RemoveContainer(context.Background(), dh, id, opts)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package composer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/node"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// ContainerName returns the name of node container.
+func ContainerName(nd *node.LocalNode) string {
+	return fmt.Sprintf("%s%s", ContainerNamePrefix, nd.Alias()[:4])
+}
+
+// ContainerEnv returns the value of environment variable from the container.
+func ContainerEnv(j types.ContainerJSON, key string) (string, bool) {
+	if j.Config == nil {
+		return "", false
+	}
+
+	for _, e := range j.Config.Env {
+		if !strings.HasPrefix(e, key+"=") {
+			continue
+		}
+
+		return e[len(key)+1:], true
+	}
+
+	return "", false
+}
+
+// PublishEndpoint returns the endpoint of the node, which can be accessed
+// from composer; the host of `SEBAK_PUBLISH` is replaced by the docker host
+// address.
+func PublishEndpoint(dh *DockerHost, j types.ContainerJSON) (endpoint string, err error) {
+	publish, found := ContainerEnv(j, "SEBAK_PUBLISH")
+	if !found {
+		err = fmt.Errorf("`SEBAK_PUBLISH` not found")
+		return
+	}
+
+	var du *url.URL
+	if du, err = url.Parse(dh.Host); err != nil {
+		return
+	}
+	dhost, _, _ := net.SplitHostPort(du.Host)
+
+	var u *url.URL
+	if u, err = url.Parse(publish); err != nil {
+		return
+	}
+	_, port, _ := net.SplitHostPort(u.Host)
+
+	// if the port is published, use the port of host
+	if j.HostConfig != nil && !j.HostConfig.NetworkMode.IsHost() {
+		bindings := j.HostConfig.PortBindings[nat.Port(fmt.Sprintf("%s/tcp", port))]
+		if len(bindings) > 0 && len(bindings[0].HostPort) > 0 {
+			port = bindings[0].HostPort
+		}
+	}
+
+	u.Host = fmt.Sprintf("%s:%s", dhost, port)
+	endpoint = u.String()
+
+	return
+}
+
+// ContainerShortName returns the container name without the leading slash.
+func ContainerShortName(s []string) string {
+	if len(s) < 1 {
+		return ""
+	}
+
+	return s[0][1:]
+}
+
+// listContainers returns all the containers of docker host; it is retried by
+// the retry policy of host.
+func listContainers(ctx context.Context, dh *DockerHost, opts Options) (cl []types.Container, err error) {
+	err = dh.Retry.Do(ctx, func(ctx context.Context) (err error) {
+		c, cancel := opts.dockerContext(ctx)
+		defer cancel()
+
+		cl, err = dh.client.ContainerList(c, types.ContainerListOptions{All: true})
+		return
+	})
+
+	return
+}
+
+// Containers returns the node containers of docker host.
+func Containers(ctx context.Context, dh *DockerHost, opts Options) (containers []types.Container, err error) {
+	var cl []types.Container
+	if cl, err = listContainers(ctx, dh, opts); err != nil {
+		return
+	}
+
+	for _, i := range cl {
+		for _, name := range i.Names {
+			if !strings.HasPrefix(name[1:], ContainerNamePrefix) {
+				continue
+			}
+
+			containers = append(containers, i)
+			break
+		}
+	}
+
+	return
+}
+
+// FindContainer returns the first container, whose name contains the given
+// string; if not found, the empty container is returned without error.
+func FindContainer(ctx context.Context, dh *DockerHost, s string, opts Options) (c types.Container, err error) {
+	var cl []types.Container
+	if cl, err = listContainers(ctx, dh, opts); err != nil {
+		return
+	}
+
+	for _, i := range cl {
+		for _, name := range i.Names {
+			if !strings.Contains(name[1:], s) {
+				continue
+			}
+
+			c = i
+			return
+		}
+	}
+
+	return
+}
+
+// RemoveContainer removes the container by id; the given context should
+// live even after the operation is canceled, so the container is removed.
+func RemoveContainer(ctx context.Context, dh *DockerHost, id string, opts Options) (err error) {
+	c, cancel := opts.dockerContext(ctx)
+	defer cancel()
+
+	if err = dh.client.ContainerRemove(c, id, types.ContainerRemoveOptions{Force: true}); err != nil {
+		opts.logger().Error("failed to remove container", "error", err, "container", id)
+		return
+	}
+	opts.logger().Debug("container removed", "container", id)
+
+	return
+}
+
+// RemoveContainerByName removes the container found by `FindContainer`; if
+// not found, nothing is removed.
+func RemoveContainerByName(ctx context.Context, dh *DockerHost, s string, opts Options) (err error) {
+	var info types.Container
+	if info, err = FindContainer(ctx, dh, s, opts); err != nil {
+		return
+	}
+
+	if len(info.ID) < 1 {
+		return
+	}
+
+	return RemoveContainer(ctx, dh, info.ID, opts)
+}
+
+// cleanHost removes the node containers of docker host.
+func cleanHost(ctx context.Context, dh *DockerHost, opts Options) (err error) {
+	var cl []types.Container
+	if cl, err = Containers(ctx, dh, opts); err != nil {
+		return
+	}
+
+	for _, c := range cl {
+		if err = RemoveContainer(ctx, dh, c.ID, opts); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// listImages returns all the images of docker host; it is retried by the
+// retry policy of host.
+func listImages(ctx context.Context, dh *DockerHost, opts Options) (images []types.ImageSummary, err error) {
+	err = dh.Retry.Do(ctx, func(ctx context.Context) (err error) {
+		c, cancel := opts.dockerContext(ctx)
+		defer cancel()
+
+		images, err = dh.client.ImageList(c, types.ImageListOptions{All: true})
+		return
+	})
+
+	return
+}
+
+// FindImage returns the id of the first image, whose tag contains the given
+// string; if not found, the empty id is returned without error.
+func FindImage(ctx context.Context, dh *DockerHost, s string, opts Options) (id string, err error) {
+	var images []types.ImageSummary
+	if images, err = listImages(ctx, dh, opts); err != nil {
+		return
+	}
+
+	for _, i := range images {
+		for _, t := range i.RepoTags {
+			if strings.Contains(t, s) {
+				id = i.ID
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// RemoveImage removes the image found by `FindImage`; the image, which is not
+// found is error.
+func RemoveImage(ctx context.Context, dh *DockerHost, s string, opts Options) (err error) {
+	var id string
+	if id, err = FindImage(ctx, dh, s, opts); err != nil {
+		return
+	} else if len(id) < 1 {
+		err = fmt.Errorf("image not found: '%s'", s)
+		return
+	}
+
+	c, cancel := opts.dockerContext(ctx)
+	defer cancel()
+
+	_, err = dh.client.ImageRemove(c, id, types.ImageRemoveOptions{})
+
+	return
+}
+
+// PrepareAlpineImage returns the id of alpine image for the helper
+// containers; it is pulled if it does not exist.
+func PrepareAlpineImage(ctx context.Context, dh *DockerHost, opts Options) (imageID string, err error) {
+	if imageID, err = FindImage(ctx, dh, "alpine:latest", opts); err != nil {
+		return
+	} else if len(imageID) > 0 {
+		return
+	}
+
+	var resp io.ReadCloser
+	if resp, err = dh.client.ImagePull(ctx, "docker.io/library/alpine:latest", types.ImagePullOptions{}); err != nil {
+		return
+	}
+	_, _ = ioutil.ReadAll(resp)
+	resp.Close()
+
+	if imageID, err = FindImage(ctx, dh, "alpine:latest", opts); err != nil {
+		return
+	} else if len(imageID) < 1 {
+		err = fmt.Errorf("failed to pull alpine:latest")
+	}
+
+	return
+}
+
+// hostIP returns the internal ip of docker host by running the container in
+// the host network.
+func hostIP(ctx context.Context, dh *DockerHost, opts Options) (ip string, err error) {
+	log := opts.logger()
+
+	var imageID string
+	if imageID, err = PrepareAlpineImage(ctx, dh, opts); err != nil {
+		return
+	}
+
+	containerName := "sebak-network-composer-get-ip"
+
+	if err = RemoveContainerByName(ctx, dh, containerName, opts); err != nil {
+		return
+	}
+
+	containerConfig := &container.Config{
+		Image:        imageID,
+		AttachStdin:  false,
+		AttachStdout: false,
+		Tty:          false,
+		OpenStdin:    false,
+		Entrypoint: []string{
+			"/bin/sh",
+			"-c",
+			"/sbin/ip route | grep '^default ' | sed -e 's/.* src //g' -e 's/ metric.*//g'",
+		},
+	}
+	containerHostConfig := &container.HostConfig{
+		NetworkMode: "host",
+	}
+
+	c, cancel := opts.dockerContext(ctx)
+	defer cancel()
+	var containerBody container.ContainerCreateCreatedBody
+	containerBody, err = dh.client.ContainerCreate(
+		c,
+		containerConfig,
+		containerHostConfig,
+		&network.NetworkingConfig{},
+		containerName,
+	)
+	if err != nil {
+		log.Error("failed to create container", "error", err)
+		return
+	}
+	defer RemoveContainer(context.Background(), dh, containerBody.ID, opts)
+
+	if err = dh.client.ContainerStart(c, containerBody.ID, types.ContainerStartOptions{}); err != nil {
+		log.Error("failed to start container", "error", err)
+		return
+	}
+
+	if _, err = dh.client.ContainerWait(c, containerBody.ID); err != nil {
+		return
+	}
+
+	var out io.ReadCloser
+	if out, err = dh.client.ContainerLogs(c, containerBody.ID, types.ContainerLogsOptions{ShowStdout: true}); err != nil {
+		return
+	}
+	defer out.Close()
+
+	var b bytes.Buffer
+	if _, err = stdcopy.StdCopy(&b, ioutil.Discard, out); err != nil {
+		return
+	}
+
+	if ip = strings.TrimSpace(b.String()); len(ip) < 1 {
+		err = fmt.Errorf("default route not found")
+	}
+
+	return
+}
+
+// runNode creates and starts the container of node; the id is returned even
+// if failed to start, so the container can be removed.
+func runNode(ctx context.Context, conf *Config, dh *DockerHost, nd *node.LocalNode, opts DeployOptions) (id string, err error) {
+	log := opts.logger()
+
+	var images []types.ImageSummary
+	if images, err = listImages(ctx, dh, opts.Options); err != nil {
+		log.Error("failed to get image list", "error", err)
+		return
+	}
+
+	var imageID string
+	for _, i := range images {
+		if _, found := common.InStringArray(i.RepoTags, opts.image()); found {
+			imageID = i.ID
+			break
+		}
+	}
+
+	if len(imageID) < 1 {
+		err = &ImageMissingError{Host: dh.Name, Image: opts.image()}
+		log.Error("failed to find the image", "image", opts.image(), "error", err)
+		return
+	}
+
+	var envValidators []string
+	for _, v := range nd.GetValidators() {
+		s := fmt.Sprintf("%s?address=%s", v.Endpoint(), v.Address())
+		envValidators = append(envValidators, s)
+	}
+
+	nn := dh.NodeNetworks[nd.Address()]
+
+	_, port, _ := net.SplitHostPort(nd.Endpoint().Host)
+	if !conf.Network.IsHost() {
+		port = fmt.Sprintf("%d", BasePort)
+	}
+	bindEndpoint, _ := common.NewEndpointFromString(nd.Endpoint().String())
+	bindEndpoint.Host = fmt.Sprintf("0.0.0.0:%s", port)
+
+	envs := []string{
+		fmt.Sprintf("SEBAK_NODE_ALIAS=%s", nd.Alias()),
+		"SEBAK_TLS_CERT=/sebak.crt",
+		"SEBAK_TLS_KEY=/sebak.key",
+		fmt.Sprintf("SEBAK_LOG_LEVEL=%s", opts.sebakLogLevel()),
+		fmt.Sprintf("SEBAK_SECRET_SEED=%s", nd.Keypair().Seed()),
+		fmt.Sprintf("SEBAK_NETWORK_ID=%s", NetworkID),
+		fmt.Sprintf("SEBAK_BIND=%s", bindEndpoint.String()),
+		fmt.Sprintf("SEBAK_PUBLISH=%s", nd.Endpoint().String()),
+		fmt.Sprintf("SEBAK_GENESIS_BLOCK=%s", conf.Genesis),
+		fmt.Sprintf("SEBAK_COMMON_ACCOUNT=%s", conf.Common),
+		fmt.Sprintf("SEBAK_VALIDATORS=self %s", strings.Join(envValidators, " ")),
+	}
+	envs = append(envs, dh.Env...)
+
+	var mounts []mount.Mount
+	for _, v := range dh.Volume {
+		m := mount.Mount{Type: mount.TypeBind, Source: v.Source, Target: v.Target}
+		mounts = append(mounts, m)
+	}
+
+	resources := nodeResources(conf, dh, nd)
+
+	var containerResources container.Resources
+	if containerResources, err = resources.ContainerResources(); err != nil {
+		return
+	}
+
+	var restartPolicy container.RestartPolicy
+	if restartPolicy, err = resources.RestartPolicy(); err != nil {
+		return
+	}
+
+	containerConfig := &container.Config{
+		Image:        imageID,
+		AttachStdin:  false,
+		AttachStdout: false,
+		ExposedPorts: nat.PortSet{nat.Port(port): {}},
+		Tty:          false,
+		OpenStdin:    false,
+		Entrypoint:   []string{"/bin/sh", "/entrypoint.sh"},
+		Env:          envs,
+	}
+	containerHostConfig := &container.HostConfig{
+		Mounts: mounts,
+		PortBindings: nat.PortMap{
+			nat.Port(fmt.Sprintf("%d/tcp", BasePort)): []nat.PortBinding{
+				{
+					HostIP:   "0.0.0.0",
+					HostPort: fmt.Sprintf("%d", nn.HostPort),
+				},
+			},
+		},
+		NetworkMode:   "host",
+		Resources:     containerResources,
+		RestartPolicy: restartPolicy,
+	}
+
+	networkingConfig := &network.NetworkingConfig{}
+	if !conf.Network.IsHost() {
+		containerConfig.ExposedPorts = nat.PortSet{nat.Port(fmt.Sprintf("%d/tcp", BasePort)): {}}
+		containerHostConfig.NetworkMode = container.NetworkMode(conf.Network.Name)
+		networkingConfig.EndpointsConfig = map[string]*network.EndpointSettings{
+			conf.Network.Name: {
+				IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: nn.IP},
+			},
+		}
+	}
+
+	c, cancel := opts.dockerContext(ctx)
+	defer cancel()
+
+	var containerBody container.ContainerCreateCreatedBody
+	containerBody, err = dh.client.ContainerCreate(
+		c,
+		containerConfig,
+		containerHostConfig,
+		networkingConfig,
+		ContainerName(nd),
+	)
+	if err != nil {
+		// the docker client 1.13 has no typed error for the conflict, so it
+		// depends on the message of docker daemon, like `Conflict. The
+		// container name "/scn.GDXJ" is already in use by container ...`.
+		if strings.Contains(err.Error(), "is already in use") {
+			err = &ContainerConflictError{Host: dh.Name, Container: ContainerName(nd)}
+		}
+		log.Error("failed to create container", "error", err)
+		return
+	}
+
+	id = containerBody.ID
+
+	if err = dh.client.ContainerStart(c, containerBody.ID, types.ContainerStartOptions{}); err != nil {
+		log.Error("failed to start container", "error", err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,85 @@
+package composer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HostUnreachableError means the docker host can not be connected.
+type HostUnreachableError struct {
+	Host string
+	Err  error
+}
+
+func (e *HostUnreachableError) Error() string {
+	return fmt.Sprintf("docker host, '%s' is unreachable: %v", e.Host, e.Err)
+}
+
+// ImageMissingError means the sebak image is not found in the docker host.
+type ImageMissingError struct {
+	Host  string
+	Image string
+}
+
+func (e *ImageMissingError) Error() string {
+	return fmt.Sprintf("image, '%s' not found in docker host, '%s'", e.Image, e.Host)
+}
+
+// ContainerConflictError means the container of same name already exists.
+type ContainerConflictError struct {
+	Host      string
+	Container string
+}
+
+func (e *ContainerConflictError) Error() string {
+	return fmt.Sprintf(
+		"container, '%s' already exists in docker host, '%s'; remove it or run with --force",
+		e.Container, e.Host,
+	)
+}
+
+// NodeUnhealthyError means the node container is not running properly.
+type NodeUnhealthyError struct {
+	Node   string
+	Reason string
+}
+
+func (e *NodeUnhealthyError) Error() string {
+	return fmt.Sprintf("node, '%s' is unhealthy: %s", e.Node, e.Reason)
+}
+
+// MultiError aggregates the errors of the operations over hosts and nodes.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	if len(m) == 1 {
+		return m[0].Error()
+	}
+
+	s := make([]string, len(m))
+	for i, err := range m {
+		s[i] = "  * " + err.Error()
+	}
+
+	return fmt.Sprintf("%d errors occurred:\n%s", len(m), strings.Join(s, "\n"))
+}
+
+// Append adds the error; nil is ignored and MultiError is flattened.
+func (m *MultiError) Append(err error) {
+	switch e := err.(type) {
+	case nil:
+	case MultiError:
+		*m = append(*m, e...)
+	default:
+		*m = append(*m, err)
+	}
+}
+
+// ErrorOrNil returns nil if no error is appended.
+func (m MultiError) ErrorOrNil() error {
+	if len(m) < 1 {
+		return nil
+	}
+
+	return m
+}
@@ -0,0 +1,188 @@
+package composer
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+const (
+	NetworkModeHost    string = "host"
+	NetworkModeBridge  string = "bridge"
+	NetworkModeOverlay string = "overlay"
+
+	defaultNetworkName   string = "scn.network"
+	defaultNetworkSubnet string = "172.30.0.0/16"
+)
+
+// NetworkConfig decides how the nodes are connected. By default, the nodes
+// use the host network and are distinguished by port. With "bridge", the
+// nodes of each host are connected to the user-defined bridge network and
+// talk to the nodes through the published ports of hosts. With "overlay",
+// the nodes of all hosts are connected to one attachable overlay network and
+// talk to each other directly; the docker hosts must be joined to swarm.
+type NetworkConfig struct {
+	Mode   string `toml:"mode"`
+	Name   string `toml:"name"`
+	Subnet string `toml:"subnet"`
+}
+
+func (n *NetworkConfig) Validate() error {
+	switch n.Mode {
+	case "":
+		n.Mode = NetworkModeHost
+	case NetworkModeHost, NetworkModeBridge, NetworkModeOverlay:
+	default:
+		return fmt.Errorf("unknown network mode, '%s'", n.Mode)
+	}
+
+	if len(n.Name) < 1 {
+		n.Name = defaultNetworkName
+	}
+	if len(n.Subnet) < 1 {
+		n.Subnet = defaultNetworkSubnet
+	}
+	if _, _, err := net.ParseCIDR(n.Subnet); err != nil {
+		return fmt.Errorf("invalid network subnet, '%s': %v", n.Subnet, err)
+	}
+
+	return nil
+}
+
+func (n NetworkConfig) IsHost() bool {
+	return n.Mode == NetworkModeHost
+}
+
+// NodeIP returns the ip address of n'th node in the subnet; the first
+// address is left for gateway.
+func (n NetworkConfig) NodeIP(index int) (string, error) {
+	ip, ipnet, err := net.ParseCIDR(n.Subnet)
+	if err != nil {
+		return "", err
+	}
+
+	ip = ip.Mask(ipnet.Mask).To4()
+	if ip == nil {
+		return "", fmt.Errorf("only ipv4 subnet is supported, '%s'", n.Subnet)
+	}
+
+	v := uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	v += uint32(index) + 2
+
+	nodeIP := net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	if !ipnet.Contains(nodeIP) {
+		return "", fmt.Errorf("too many nodes for subnet, '%s'", n.Subnet)
+	}
+
+	return nodeIP.String(), nil
+}
+
+// NodeNetwork is the network address of node; `IP` is the address in the
+// docker network and `HostPort` is the published port of docker host.
+type NodeNetwork struct {
+	IP       string
+	HostPort int
+}
+
+// checkNetwork checks the existing docker network has the driver and the
+// subnet of config; the node ips are assigned from the configured subnet, so
+// the other network of same name can not be used.
+func checkNetwork(resource types.NetworkResource, n NetworkConfig) error {
+	if resource.Driver != n.Mode {
+		return fmt.Errorf(
+			"network, '%s' already exists with different driver, '%s'; expected '%s'",
+			n.Name, resource.Driver, n.Mode,
+		)
+	}
+
+	var subnets []string
+	for _, c := range resource.IPAM.Config {
+		if c.Subnet == n.Subnet {
+			return nil
+		}
+		subnets = append(subnets, c.Subnet)
+	}
+
+	return fmt.Errorf(
+		"network, '%s' already exists with different subnet, %q; expected '%s'",
+		n.Name, subnets, n.Subnet,
+	)
+}
+
+// ensureNetwork creates the docker network for nodes if it does not exist;
+// the existing network must match with the config.
+func ensureNetwork(ctx context.Context, cli *client.Client, n NetworkConfig, opts Options) (err error) {
+	log := opts.logger()
+
+	ctx, cancel := opts.dockerContext(ctx)
+	defer cancel()
+
+	var resource types.NetworkResource
+	if resource, err = cli.NetworkInspect(ctx, n.Name); err == nil {
+		if err = checkNetwork(resource, n); err != nil {
+			log.Error("existing network does not match", "network", n.Name, "error", err)
+			return
+		}
+		log.Debug("network already exists", "network", n.Name)
+		return
+	} else if !client.IsErrNetworkNotFound(err) {
+		return
+	}
+
+	options := types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         n.Mode,
+		Attachable:     n.Mode == NetworkModeOverlay,
+		IPAM: &network.IPAM{
+			Config: []network.IPAMConfig{{Subnet: n.Subnet}},
+		},
+	}
+
+	if _, err = cli.NetworkCreate(ctx, n.Name, options); err != nil {
+		log.Error("failed to create network", "network", n.Name, "error", err)
+		return
+	}
+	log.Debug("network created", "network", n.Name, "mode", n.Mode, "subnet", n.Subnet)
+
+	return
+}
+
+// prepareNetworks creates the docker networks; the overlay network is
+// created only in the first host and shared with the other hosts.
+func prepareNetworks(ctx context.Context, hosts []*DockerHost, n NetworkConfig, opts Options) error {
+	if n.IsHost() {
+		return nil
+	}
+
+	for i, dh := range hosts {
+		if n.Mode == NetworkModeOverlay && i > 0 {
+			break
+		}
+
+		if err := ensureNetwork(ctx, dh.Client(), n, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeNetwork(ctx context.Context, cli *client.Client, n NetworkConfig, opts Options) error {
+	if n.IsHost() {
+		return nil
+	}
+
+	ctx, cancel := opts.dockerContext(ctx)
+	defer cancel()
+
+	err := cli.NetworkRemove(ctx, n.Name)
+	if err != nil && !client.IsErrNetworkNotFound(err) {
+		return err
+	}
+
+	return nil
+}
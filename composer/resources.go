@@ -0,0 +1,146 @@
+package composer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"boscoin.io/sebak/lib/node"
+	"github.com/docker/docker/api/types/container"
+	units "github.com/docker/go-units"
+)
+
+// Resources is the resource limits and restart policy of node container. It
+// can be set globally, by host and by node; the latter overrides the former.
+type Resources struct {
+	CPUPeriod int64    `toml:"cpu-period"`
+	CPUQuota  int64    `toml:"cpu-quota"`
+	CPUShares int64    `toml:"cpu-shares"`
+	Memory    string   `toml:"memory"`
+	PidsLimit int64    `toml:"pids-limit"`
+	Ulimits   []string `toml:"ulimits"`
+	Restart   string   `toml:"restart"`
+}
+
+// Merge returns new `Resources`, which is overridden by the set values of
+// `o`; the ulimits are overridden by name.
+func (r Resources) Merge(o Resources) Resources {
+	if o.CPUPeriod != 0 {
+		r.CPUPeriod = o.CPUPeriod
+	}
+	if o.CPUQuota != 0 {
+		r.CPUQuota = o.CPUQuota
+	}
+	if o.CPUShares != 0 {
+		r.CPUShares = o.CPUShares
+	}
+	if len(o.Memory) > 0 {
+		r.Memory = o.Memory
+	}
+	if o.PidsLimit != 0 {
+		r.PidsLimit = o.PidsLimit
+	}
+	if len(o.Restart) > 0 {
+		r.Restart = o.Restart
+	}
+
+	if len(o.Ulimits) > 0 {
+		names := map[string]int{}
+		ulimits := make([]string, len(r.Ulimits))
+		copy(ulimits, r.Ulimits)
+		for i, u := range ulimits {
+			names[strings.SplitN(u, "=", 2)[0]] = i
+		}
+		for _, u := range o.Ulimits {
+			name := strings.SplitN(u, "=", 2)[0]
+			if i, found := names[name]; found {
+				ulimits[i] = u
+				continue
+			}
+			names[name] = len(ulimits)
+			ulimits = append(ulimits, u)
+		}
+		r.Ulimits = ulimits
+	}
+
+	return r
+}
+
+func (r Resources) Validate() error {
+	if _, err := r.ContainerResources(); err != nil {
+		return err
+	}
+	if _, err := r.RestartPolicy(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r Resources) ContainerResources() (resources container.Resources, err error) {
+	resources = container.Resources{
+		CPUPeriod: r.CPUPeriod,
+		CPUQuota:  r.CPUQuota,
+		CPUShares: r.CPUShares,
+		PidsLimit: r.PidsLimit,
+	}
+
+	if len(r.Memory) > 0 {
+		if resources.Memory, err = units.RAMInBytes(r.Memory); err != nil {
+			err = fmt.Errorf("invalid memory, '%s': %v", r.Memory, err)
+			return
+		}
+	}
+
+	for _, u := range r.Ulimits {
+		var ulimit *units.Ulimit
+		if ulimit, err = units.ParseUlimit(u); err != nil {
+			err = fmt.Errorf("invalid ulimit, '%s': %v", u, err)
+			return
+		}
+		resources.Ulimits = append(resources.Ulimits, ulimit)
+	}
+
+	return
+}
+
+// RestartPolicy parses the restart policy like `docker run --restart`;
+// "no", "always", "unless-stopped" and "on-failure[:max-retry]".
+func (r Resources) RestartPolicy() (policy container.RestartPolicy, err error) {
+	if len(r.Restart) < 1 {
+		return
+	}
+
+	parts := strings.SplitN(r.Restart, ":", 2)
+	policy.Name = parts[0]
+
+	switch policy.Name {
+	case "no", "always", "unless-stopped":
+		if len(parts) > 1 {
+			err = fmt.Errorf("maximum retry count can be used only with on-failure, '%s'", r.Restart)
+		}
+	case "on-failure":
+		if len(parts) > 1 {
+			if policy.MaximumRetryCount, err = strconv.Atoi(parts[1]); err != nil {
+				err = fmt.Errorf("invalid maximum retry count, '%s'", r.Restart)
+			}
+		}
+	default:
+		err = fmt.Errorf("invalid restart policy, '%s'", r.Restart)
+	}
+
+	return
+}
+
+// nodeResources returns the merged resources for the node; the node
+// resources of host can be keyed by node address or alias.
+func nodeResources(conf *Config, dh *DockerHost, nd *node.LocalNode) Resources {
+	r := conf.Resources.Merge(dh.Resources)
+	if o, found := dh.NodeResources[nd.Address()]; found {
+		r = r.Merge(o)
+	} else if o, found := dh.NodeResources[nd.Alias()]; found {
+		r = r.Merge(o)
+	}
+
+	return r
+}
@@ -0,0 +1,175 @@
+package composer
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Retry is the retry policy of the idempotent docker calls and the http probes
+// of node. It can be set globally and by host; the latter overrides the
+// former.
+type Retry struct {
+	Attempts        int    `toml:"attempts"`
+	InitialInterval string `toml:"initial-interval"`
+	MaxInterval     string `toml:"max-interval"`
+}
+
+// DefaultRetry returns the retry policy, which is used if the retry policy is
+// not set in config.
+func DefaultRetry() Retry {
+	return Retry{Attempts: 3, InitialInterval: "500ms", MaxInterval: "5s"}
+}
+
+// Merge returns new `Retry`, which is overridden by the set values of `o`.
+func (r Retry) Merge(o Retry) Retry {
+	if o.Attempts != 0 {
+		r.Attempts = o.Attempts
+	}
+	if len(o.InitialInterval) > 0 {
+		r.InitialInterval = o.InitialInterval
+	}
+	if len(o.MaxInterval) > 0 {
+		r.MaxInterval = o.MaxInterval
+	}
+
+	return r
+}
+
+func (r Retry) Validate() error {
+	if r.Attempts < 1 {
+		return fmt.Errorf("retry attempts must be greater than 0")
+	}
+
+	initial, max, err := r.intervals()
+	if err != nil {
+		return err
+	}
+	if initial <= 0 || max < initial {
+		return fmt.Errorf("retry intervals must be 0 < initial-interval <= max-interval")
+	}
+
+	return nil
+}
+
+func (r Retry) intervals() (initial, max time.Duration, err error) {
+	if initial, err = time.ParseDuration(r.InitialInterval); err != nil {
+		err = fmt.Errorf("invalid retry initial-interval: %v", err)
+		return
+	}
+	if max, err = time.ParseDuration(r.MaxInterval); err != nil {
+		err = fmt.Errorf("invalid retry max-interval: %v", err)
+		return
+	}
+
+	return
+}
+
+// Do runs f until it succeeds, the attempts are exhausted or the context is
+// done. The interval is doubled at every attempt up to max-interval, and the
+// half of it is randomized not to make the concurrent calls retry at the same
+// time. f must make the docker or http call with the given context, which
+// records the outcome of the call for `retryable`.
+func (r Retry) Do(ctx context.Context, f func(context.Context) error) (err error) {
+	initial, max, e := r.intervals()
+	if e != nil {
+		initial, max, _ = DefaultRetry().intervals()
+	}
+
+	interval := initial
+	for attempt := 1; ; attempt++ {
+		result := &roundTripResult{}
+		err = f(context.WithValue(ctx, roundTripResultKey{}, result))
+		if err == nil || !retryable(err, result) || ctx.Err() != nil || attempt >= r.Attempts {
+			return
+		}
+
+		wait := interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1))
+		if !sleep(ctx, wait) {
+			return
+		}
+
+		if interval *= 2; interval > max {
+			interval = max
+		}
+	}
+}
+
+type roundTripResultKey struct{}
+
+// roundTripResult is the outcome of the last http round trip of one attempt;
+// the docker client does not keep the status code or the transport error in
+// the returned error, so they are recorded by `recordTransport`.
+type roundTripResult struct {
+	statusCode int
+	err        error
+}
+
+// recordTransport records the outcome of the round trip into the
+// `roundTripResult` of the request context, which is set by `Retry.Do`.
+type recordTransport struct {
+	http.RoundTripper
+}
+
+func (t recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if result, ok := req.Context().Value(roundTripResultKey{}).(*roundTripResult); ok {
+		result.err = err
+		if resp != nil {
+			result.statusCode = resp.StatusCode
+		}
+	}
+
+	return resp, err
+}
+
+// retryable returns true only if the error may be recovered by retry; the
+// network error, the timeout and the server error, 5xx. The client error,
+// 4xx, like not found and conflict, and the tls errors are permanent.
+func retryable(err error, result *roundTripResult) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	switch {
+	case result.statusCode >= 500:
+		return true
+	case result.statusCode >= 400:
+		return false
+	case result.err != nil:
+		return !isTLSError(result.err)
+	}
+
+	// the call timed out before the response
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// isTLSError returns true if the error is from the tls handshake, like the
+// unknown certificate authority or the rejected client certificate.
+func isTLSError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCertificate x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &invalidCertificate) || errors.As(err, &hostname) {
+		return true
+	}
+
+	// the alert of remote peer, like "remote error: tls: bad certificate"
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// sleep waits for the duration; it returns false if the context is done
+// before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,143 @@
+package composer
+
+import (
+	"fmt"
+	"strings"
+
+	"boscoin.io/sebak/lib/common/keypair"
+	"boscoin.io/sebak/lib/node"
+	"github.com/docker/docker/api/types"
+)
+
+// MatchNode checks whether the selector points the node container of the
+// host; the selector can be host name, container name, node alias or node
+// address. The container name has the first characters of node address, so
+// the node alias and address are matched by it. If host is nil, the host name
+// is not matched.
+func MatchNode(s string, host *DockerHost, container string) bool {
+	switch {
+	case len(s) < 1:
+		return false
+	case host != nil && s == host.Name, s == container:
+		return true
+	}
+
+	short := strings.TrimPrefix(container, ContainerNamePrefix)
+	if len(short) < 1 || short == container || !strings.HasPrefix(s, short) {
+		return false
+	}
+
+	return isNodeAlias(s) || isNodeAddress(s)
+}
+
+// isNodeAlias checks the format of node alias, `<first 4 characters of
+// address>.<last 4 characters of address>`.
+func isNodeAlias(s string) bool {
+	return len(s) == 9 && s[4] == '.'
+}
+
+func isNodeAddress(s string) bool {
+	kp, err := keypair.Parse(s)
+
+	return err == nil && kp.Address() == s
+}
+
+// NodeMatcher matches the node containers with the node selectors and keeps
+// the matched selectors, so the selector, which matches no node can be
+// reported by `Err`. If no selector is given, every node is matched.
+type NodeMatcher struct {
+	selectors []string
+	matched   map[string]bool
+}
+
+func NewNodeMatcher(selectors []string) *NodeMatcher {
+	return &NodeMatcher{selectors: selectors, matched: map[string]bool{}}
+}
+
+// Match checks whether one of the selectors points the node container; see
+// `MatchNode`.
+func (m *NodeMatcher) Match(host *DockerHost, container string) bool {
+	if len(m.selectors) < 1 {
+		return true
+	}
+
+	var found bool
+	for _, s := range m.selectors {
+		if MatchNode(s, host, container) {
+			m.matched[s] = true
+			found = true
+		}
+	}
+
+	return found
+}
+
+// Err returns error for the first selector, which matches no node.
+func (m *NodeMatcher) Err() error {
+	for _, s := range m.selectors {
+		if !m.matched[s] {
+			return fmt.Errorf("node not found, '%s'", s)
+		}
+	}
+
+	return nil
+}
+
+// FilterContainers returns the containers of the host, which match with the
+// given node selectors; see `MatchNode`. If no selector is given, all the
+// containers are returned. The selectors, which match no container are
+// ignored; use `NodeMatcher` to find them.
+func FilterContainers(host *DockerHost, cl []types.Container, selectors []string) (filtered []types.Container) {
+	m := NewNodeMatcher(selectors)
+	for _, c := range cl {
+		if m.Match(host, ContainerShortName(c.Names)) {
+			filtered = append(filtered, c)
+		}
+	}
+
+	return
+}
+
+// SelectHosts returns the docker hosts of the nodes, which the node
+// selectors point, without connecting to them; the nodes are found by the
+// keys of config. If no selector is given, or one of selectors points no node
+// of config, all the hosts are returned, so the selector is checked against
+// the running containers.
+func (c *Config) SelectHosts(selectors []string) []*DockerHost {
+	if len(selectors) < 1 {
+		return c.DockerHosts
+	}
+
+	selected := map[*DockerHost]bool{}
+	for _, s := range selectors {
+		var found bool
+		for _, dh := range c.DockerHosts {
+			if s == dh.Name || s == dh.Host {
+				selected[dh] = true
+				found = true
+				continue
+			}
+
+			for _, kp := range dh.Keys {
+				if MatchNode(s, dh, ContainerNamePrefix+node.MakeAlias(kp.Address())[:4]) {
+					selected[dh] = true
+					found = true
+					break
+				}
+			}
+		}
+
+		if !found {
+			return c.DockerHosts
+		}
+	}
+
+	var hosts []*DockerHost
+	for _, dh := range c.DockerHosts {
+		if selected[dh] {
+			hosts = append(hosts, dh)
+		}
+	}
+
+	return hosts
+}
@@ -0,0 +1,195 @@
+package composer
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// NodeInfo is the response of node info endpoint of SEBAK node.
+type NodeInfo struct {
+	Node struct {
+		Version struct {
+			Version   string `json:"version"`
+			GitCommit string `json:"git-commit"`
+			GitState  string `json:"git-state"`
+			BuildDate string `json:"build-date"`
+		} `json:"version"`
+		State      string `json:"state"`
+		Alias      string `json:"alias"`
+		Address    string `json:"address"`
+		Endpoint   string `json:"endpoint"`
+		Validators map[string]struct {
+			Address  string `json:"address"`
+			Alias    string `json:"alias"`
+			Endpoint string `json:"endpoint"`
+		} `json:"validators"`
+	} `json:"node"`
+	Block struct {
+		Height   uint64 `json:"height"`
+		Hash     string `json:"hash"`
+		TotalTxs uint64 `json:"total-txs"`
+		TotalOps uint64 `json:"total-ops"`
+	} `json:"block"`
+}
+
+// NodeTarget is the running SEBAK node, which can be accessed from composer.
+type NodeTarget struct {
+	Host      *DockerHost
+	Container string
+	Endpoint  string
+}
+
+// NodeStatus is the response of node info endpoint of `NodeTarget`.
+type NodeStatus struct {
+	Target NodeTarget
+	Info   NodeInfo
+	Body   []byte
+	Error  error
+}
+
+func (s NodeStatus) Name() string {
+	if len(s.Info.Node.Alias) > 0 {
+		return s.Info.Node.Alias
+	}
+
+	return s.Target.Container
+}
+
+func (s NodeStatus) BlockKey() string {
+	return fmt.Sprintf("%d/%s", s.Info.Block.Height, s.Info.Block.Hash)
+}
+
+// StatusOptions is the options of `Status` and `NodeStatuses`.
+type StatusOptions struct {
+	Options
+	// HTTPTimeout limits each request to node; 0 is no limit.
+	HTTPTimeout time.Duration
+}
+
+// Targets returns the running nodes of the hosts. The hosts, which fail to
+// list the containers, are skipped and their errors are returned together
+// with the targets of the other hosts.
+func Targets(ctx context.Context, hosts []*DockerHost, opts Options) (targets []NodeTarget, err error) {
+	log := opts.logger()
+
+	var errs MultiError
+	for _, dh := range hosts {
+		cl, e := Containers(ctx, dh, opts)
+		if e != nil {
+			errs.Append(&HostUnreachableError{Host: dh.Name, Err: e})
+			continue
+		}
+
+		for _, c := range cl {
+			if c.State == "exited" {
+				continue
+			}
+
+			var j types.ContainerJSON
+			e = dh.Retry.Do(ctx, func(ctx context.Context) (err error) {
+				dctx, cancel := opts.dockerContext(ctx)
+				defer cancel()
+
+				j, err = dh.client.ContainerInspect(dctx, c.ID)
+				return
+			})
+			if e != nil {
+				errs.Append(fmt.Errorf("host, '%s': %v", dh.Name, e))
+				continue
+			}
+
+			endpoint, e := PublishEndpoint(dh, j)
+			if e != nil {
+				log.Error("failed to get endpoint", "container", ContainerShortName(c.Names), "error", e)
+				continue
+			}
+
+			targets = append(targets, NodeTarget{Host: dh, Container: ContainerShortName(c.Names), Endpoint: endpoint})
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Host.Name != targets[j].Host.Name {
+			return targets[i].Host.Name < targets[j].Host.Name
+		}
+		return targets[i].Container < targets[j].Container
+	})
+
+	return targets, errs.ErrorOrNil()
+}
+
+// NodeStatuses requests the node info of the targets concurrently; the
+// request is retried by the retry policy of host. The failure is kept in
+// `NodeStatus.Error`.
+func NodeStatuses(ctx context.Context, targets []NodeTarget, opts StatusOptions) []NodeStatus {
+	statuses := make([]NodeStatus, len(targets))
+
+	var wg sync.WaitGroup
+	wg.Add(len(targets))
+	for i, t := range targets {
+		go func(i int, t NodeTarget) {
+			defer wg.Done()
+
+			status := NodeStatus{Target: t}
+			status.Error = t.Host.Retry.Do(ctx, func(ctx context.Context) (err error) {
+				status.Body, err = httpGet(ctx, t.Endpoint, opts.HTTPTimeout)
+				return
+			})
+			if status.Error == nil {
+				status.Error = json.Unmarshal(status.Body, &status.Info)
+			}
+			statuses[i] = status
+		}(i, t)
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// Status returns the node info of all the running nodes of config.
+func Status(ctx context.Context, conf *Config, opts StatusOptions) (statuses []NodeStatus, err error) {
+	var targets []NodeTarget
+	if targets, err = Targets(ctx, conf.DockerHosts, opts.Options); err != nil {
+		return
+	}
+
+	return NodeStatuses(ctx, targets, opts), nil
+}
+
+func httpGet(ctx context.Context, u string, timeout time.Duration) (body []byte, err error) {
+	c := &http.Client{
+		Timeout: timeout,
+		Transport: recordTransport{&http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		}},
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequest("GET", u, nil); err != nil {
+		return
+	}
+
+	var resp *http.Response
+	if resp, err = c.Do(req.WithContext(ctx)); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to get; status=%v", resp.StatusCode)
+		return
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
@@ -5,7 +5,10 @@ set -x
 
 env | sort
 
-if [ ${SEBAK_INITIALIZE} -eq 1 ];then
+# the storage restored by `sebak-network-composer restore` is kept.
+if [ -f /sebak-network-composer.restored ];then
+    echo "storage is restored; SEBAK_INITIALIZE is ignored"
+elif [ ${SEBAK_INITIALIZE} -eq 1 ];then
     rm -rf $(echo $SEBAK_STORAGE | sed -e 's@file://@@g')/* || true
 fi
 
@@ -48,5 +48,5 @@ require (
 	golang.org/x/sys v0.0.0-20181128092732-4ed8d59d0b35
 	golang.org/x/text v0.3.0
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
-	gopkg.in/yaml.v2 v2.2.2 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )